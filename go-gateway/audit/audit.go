@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record es una entrada del log de auditoría. Cada registro incluye el hash del
+// anterior, de modo que cualquier edición o borrado rompe la cadena.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Actor   string    `json:"actor"`
+	Subject string    `json:"subject"`
+	Method  string    `json:"method,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+	Status  int       `json:"status,omitempty"`
+	// RequestID correlaciona el registro con los logs (ver requestid)
+	RequestID string `json:"request_id,omitempty"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+var (
+	file     *os.File
+	lastHash string
+	mu       sync.Mutex
+)
+
+// Init abre (o crea) el archivo de auditoría en modo append-only y recupera el
+// último hash de la cadena.
+func Init(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	last, err := readLastHash(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		file.Close()
+	}
+	file = f
+	lastHash = last
+	return nil
+}
+
+// Log agrega un registro encadenado al archivo y lo sincroniza a disco.
+func Log(rec Record) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file == nil {
+		return errors.New("audit log no inicializado")
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	rec.PrevHash = lastHash
+	rec.Hash = ""
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(append([]byte(lastHash), body...))
+	rec.Hash = hex.EncodeToString(sum[:])
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	lastHash = rec.Hash
+	return nil
+}
+
+// readLastHash devuelve el hash del último registro del archivo, o "" si no existe.
+func readLastHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var last string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return "", errors.New("audit log corrupto: " + err.Error())
+		}
+		last = rec.Hash
+	}
+	return last, sc.Err()
+}
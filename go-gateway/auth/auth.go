@@ -1,7 +1,7 @@
 package auth
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 
 	"bytes"
@@ -13,19 +13,24 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gin-gonic/gin"
-
 	firebase "firebase.google.com/go/v4"
 	firebaseAuth "firebase.google.com/go/v4/auth"
+	"firebase.google.com/go/v4/errorutils"
 
 	"github.com/golang-jwt/jwt/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"google.golang.org/api/option"
+
+	"gateway/i18n"
+	"gateway/problem"
+	"gateway/tracing"
 )
 
 // Globals
@@ -45,6 +50,34 @@ type RefreshToken struct {
 var refreshStore = map[string]RefreshToken{}
 var refreshMu sync.Mutex
 
+// refreshReuseGrace es cuánto tiempo un refresh recién rotado sigue devolviendo
+// la sesión que emitió. El dashboard pide varias cosas a la vez y, con el
+// access vencido, todas llegan juntas a /refresh con el mismo token.
+const refreshReuseGrace = 10 * time.Second
+
+// rotation es la renovación en curso (o recién hecha) de un refresh token.
+type rotation struct {
+	done chan struct{}
+	resp LoginResp
+	err  error
+}
+
+// rotations: refresh token consumido -> su renovación, durante refreshReuseGrace.
+var rotations = map[string]*rotation{}
+
+// ErrInvalidCredentials indica que Firebase rechazó email/password o el idToken.
+var ErrInvalidCredentials = errors.New("credenciales incorrectas")
+
+// ErrFirebase indica que el login falló en Firebase por algo que no son las
+// credenciales (caída, cuota, API key, usuario deshabilitado...).
+var ErrFirebase = errors.New("firebase")
+
+// Errores de RotateRefreshToken
+var (
+	ErrRefreshInvalid = errors.New("refresh token inválido")
+	ErrRefreshExpired = errors.New("refresh expirado")
+)
+
 // InitFirebase inicializa Firebase Admin y carga la clave RSA desde service account.
 func InitFirebase(saPath string) error {
 	// Init Firebase Admin
@@ -111,7 +144,15 @@ func generateRandomToken(size int) (string, error) {
 
 // generateRS256Token genera un JWT RS256 firmado con la clave privada del service account.
 // claims mínimos: sub (uid), iat, exp, iss
-func generateRS256Token(uid string, minutes int) (string, error) {
+// Incluye además los roles del usuario (custom claims de Firebase).
+func generateRS256Token(ctx context.Context, uid string, ttl time.Duration) (string, error) {
+	return signAccessToken(uid, ttl, jwt.MapClaims{
+		"roles": lookupRoles(ctx, uid),
+	})
+}
+
+// signAccessToken firma un access token RS256 con los claims base más los extra.
+func signAccessToken(uid string, ttl time.Duration, extra jwt.MapClaims) (string, error) {
 	if rsaPrivateKey == nil {
 		return "", errors.New("rsa private key no inicializada")
 	}
@@ -119,27 +160,16 @@ func generateRS256Token(uid string, minutes int) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": uid,
 		"iat": now.Unix(),
-		"exp": now.Add(time.Duration(minutes) * time.Minute).Unix(),
+		"exp": now.Add(ttl).Unix(),
 		"iss": "gateway",
 	}
+	for k, v := range extra {
+		claims[k] = v
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 	return token.SignedString(rsaPrivateKey)
 }
 
-// verifyRS256Token verifica token RS256 usando la clave pública derivada
-func verifyRS256Token(tok string) (*jwt.Token, error) {
-	if rsaPublicKey == nil {
-		return nil, errors.New("rsa public key no inicializada")
-	}
-	return jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) {
-		// validar método
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errors.New("algoritmo inesperado")
-		}
-		return rsaPublicKey, nil
-	})
-}
-
 /*
 	---------------- RegisterBasic ----------------
 
@@ -154,195 +184,64 @@ func RegisterBasicHandler(w http.ResponseWriter, r *http.Request) {
 		Name     string `json:"name"`
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, r, problem.MethodNotAllowed, "")
 		return
 	}
 	var b bodyReq
 	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
-		http.Error(w, "json inválido: "+err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, problem.InvalidRequest, "detail.invalid_json")
 		return
 	}
 	params := (&firebaseAuth.UserToCreate{}).Email(b.Email).Password(b.Password).DisplayName(b.Name)
-	user, err := firebaseAuthClient.CreateUser(context.Background(), params)
+	ctx, span := firebaseSpan(r.Context(), "CreateUser")
+	user, err := firebaseAuthClient.CreateUser(ctx, params)
+	tracing.End(span, err)
 	if err != nil {
-		http.Error(w, "Error registrando usuario: "+err.Error(), http.StatusInternalServerError)
+		code, detail := createUserProblem(r.Context(), err)
+		problem.Write(w, r, code, detail)
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Usuario registrado",
+		"message": i18n.T(i18n.FromRequest(r), "auth.registered"),
 		"uid":     user.UID,
 	})
 }
 
-/*
-	---------------- LoginBasic ----------------
-
-POST /login-basic
-Body: { "email":"", "password":"" }
-Uses Firebase REST to authenticate and issues gateway RS256 access token + refresh token.
-*/
-func LoginBasicHandler(w http.ResponseWriter, r *http.Request) {
-	type bodyReq struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	var b bodyReq
-	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
-		http.Error(w, "json inválido", http.StatusBadRequest)
-		return
-	}
-	apiKey := os.Getenv("FIREBASE_API_KEY")
-	if apiKey == "" {
-		http.Error(w, "FIREBASE_API_KEY not configured", http.StatusInternalServerError)
-		return
-	}
-	url := "https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword?key=" + apiKey
-	reqBody := map[string]interface{}{
-		"email":             b.Email,
-		"password":          b.Password,
-		"returnSecureToken": true,
-	}
-	jsonBody, _ := json.Marshal(reqBody)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(jsonBody))
-	if err != nil {
-		http.Error(w, "error contacting firebase: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		http.Error(w, "Credenciales incorrectas: "+string(bodyBytes), http.StatusUnauthorized)
-		return
-	}
-	var fbResp map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &fbResp); err != nil {
-		http.Error(w, "error parsing firebase response: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	idToken, _ := fbResp["idToken"].(string)
-	localId, _ := fbResp["localId"].(string)
-
-	// Optionally validate idToken with Admin SDK to ensure it's good (Firebase already issued it)
-	_, _ = firebaseAuthClient.VerifyIDToken(context.Background(), idToken)
-
-	// Generate RS256 access token
-	access, err := generateRS256Token(localId, 30)
-	if err != nil {
-		http.Error(w, "error generating access token: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	refresh, err := generateRandomToken(48)
-	if err != nil {
-		http.Error(w, "error generating refresh token: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	rt := RefreshToken{
-		Token:     refresh,
-		UID:       localId,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
-		CreatedAt: time.Now(),
-	}
-	refreshMu.Lock()
-	refreshStore[refresh] = rt
-	refreshMu.Unlock()
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"access_token":  access,
-		"refresh_token": refresh,
-		"firebase_id":   idToken,
-		"uid":           localId,
-		"expires_in":    1800,
-	})
-}
-
-/*
-	---------------- Login (via firebase idToken) ----------------
-
-POST /login
-Body: { "token": "<firebase idToken>" }
-*/
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	type bodyReq struct {
-		Token string `json:"token"`
-	}
-	var b bodyReq
-	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
-		http.Error(w, "json inválido", http.StatusBadRequest)
-		return
-	}
-	token, err := firebaseAuthClient.VerifyIDToken(context.Background(), b.Token)
-	if err != nil {
-		http.Error(w, "Token Firebase inválido: "+err.Error(), http.StatusUnauthorized)
-		return
-	}
-	uid := token.UID
-	access, err := generateRS256Token(uid, 30)
-	if err != nil {
-		http.Error(w, "error generating access token: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	refresh, err := generateRandomToken(48)
-	if err != nil {
-		http.Error(w, "error generating refresh token: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	rt := RefreshToken{Token: refresh, UID: uid, ExpiresAt: time.Now().Add(7 * 24 * time.Hour), CreatedAt: time.Now()}
-	refreshMu.Lock()
-	refreshStore[refresh] = rt
-	refreshMu.Unlock()
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"access_token":  access,
-		"refresh_token": refresh,
-		"uid":           uid,
-	})
-}
-
 /*
 	---------------- Refresh ----------------
 
 POST /refresh { "refresh_token": "..." }
+Sin refresh_token en el body se usa la cookie de refresh (si existe), y en ese
+caso las cookies rotadas se reescriben en la respuesta.
 */
 func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	type bodyReq struct {
 		RefreshToken string `json:"refresh_token"`
 	}
 	var b bodyReq
-	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
-		http.Error(w, "json inválido", http.StatusBadRequest)
-		return
-	}
-	refreshMu.Lock()
-	rt, ok := refreshStore[b.RefreshToken]
-	if !ok {
-		refreshMu.Unlock()
-		http.Error(w, "refresh token inválido", http.StatusUnauthorized)
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil && err != io.EOF {
+		problem.Write(w, r, problem.InvalidRequest, "detail.invalid_json")
 		return
 	}
-	delete(refreshStore, b.RefreshToken)
-	refreshMu.Unlock()
-	if time.Now().After(rt.ExpiresAt) {
-		http.Error(w, "refresh expirado", http.StatusUnauthorized)
-		return
+	fromCookie := false
+	if b.RefreshToken == "" {
+		b.RefreshToken = RefreshTokenFromCookie(r)
+		fromCookie = b.RefreshToken != ""
 	}
-	newAccess, err := generateRS256Token(rt.UID, 30)
+	resp, err := RotateRefreshToken(r.Context(), b.RefreshToken)
 	if err != nil {
-		http.Error(w, "error generando access: "+err.Error(), http.StatusInternalServerError)
+		if fromCookie && errors.Is(err, ErrRefreshExpired) {
+			ClearSessionCookies(w)
+		}
+		problem.Write(w, r, problem.SessionExpired, refreshProblemDetail(err))
 		return
 	}
-	newRefresh, err := generateRandomToken(48)
-	if err != nil {
-		http.Error(w, "error generando refresh: "+err.Error(), http.StatusInternalServerError)
-		return
+	if fromCookie {
+		SetSessionCookies(w, resp)
 	}
-	refreshMu.Lock()
-	refreshStore[newRefresh] = RefreshToken{Token: newRefresh, UID: rt.UID, ExpiresAt: time.Now().Add(7 * 24 * time.Hour), CreatedAt: time.Now()}
-	refreshMu.Unlock()
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"access_token":  newAccess,
-		"refresh_token": newRefresh,
+		"access_token":  resp.AccessToken,
+		"refresh_token": resp.RefreshToken,
 	})
 }
 
@@ -359,12 +258,10 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	var b bodyReq
 	_ = json.NewDecoder(r.Body).Decode(&b)
 	if b.RefreshToken != "" {
-		refreshMu.Lock()
-		rt, _ := refreshStore[b.RefreshToken]
-		delete(refreshStore, b.RefreshToken)
-		refreshMu.Unlock()
-		if b.RevokeFirebase && rt.UID != "" {
-			_ = firebaseAuthClient.RevokeRefreshTokens(context.Background(), rt.UID)
+		uid := RevokeRefreshToken(b.RefreshToken)
+		if b.RevokeFirebase && uid != "" {
+			ctx, span := firebaseSpan(r.Context(), "RevokeRefreshTokens")
+			tracing.End(span, firebaseAuthClient.RevokeRefreshTokens(ctx, uid))
 		}
 	}
 	json.NewEncoder(w).Encode(map[string]string{"message": "logout ok"})
@@ -390,39 +287,165 @@ type LoginResp struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	UID          string `json:"uid"`
-}
-
-// ValidateAccessToken verifica que un access token RS256 generado por el gateway sea válido.
-// Devuelve true si el token es válido.
-func ValidateAccessToken(tokenStr string) bool {
-	if tokenStr == "" {
-		return false
-	}
-	tok, err := VerifyRS256Token(tokenStr)
-	if err != nil || tok == nil || !tok.Valid {
-		return false
-	}
-	return true
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	FirebaseID   string `json:"firebase_id,omitempty"`
 }
 
 // LoginWithIDToken valida un idToken de Firebase (string) y retorna access+refresh token del gateway.
 // Útil para que main.go pueda llamar programáticamente.
-func LoginWithIDToken(idToken string) (LoginResp, error) {
-	var out LoginResp
+func LoginWithIDToken(ctx context.Context, idToken string) (out LoginResp, err error) {
+	defer func() { countLogin(loginIDToken, err) }()
 
 	if idToken == "" {
-		return out, errors.New("idToken vacío")
+		return out, fmt.Errorf("%w: idToken vacío", ErrInvalidCredentials)
 	}
 
 	// Verificar ID token con Firebase Admin
-	fbTok, err := firebaseAuthClient.VerifyIDToken(context.Background(), idToken)
+	fctx, span := firebaseSpan(ctx, "VerifyIDToken")
+	fbTok, err := firebaseAuthClient.VerifyIDToken(fctx, idToken)
+	tracing.End(span, err)
+	if err != nil {
+		if firebaseAuth.IsIDTokenInvalid(err) {
+			return out, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+		// P.ej. no se pudieron bajar las claves públicas: no se sabe si el token era bueno
+		return out, fmt.Errorf("%w: %v", ErrFirebase, err)
+	}
+
+	return issueSession(ctx, fbTok.UID)
+}
+
+// LoginWithPassword autentica email/password contra Firebase (REST) y emite la
+// sesión del gateway. Devuelve ErrInvalidCredentials si Firebase los rechaza y
+// ErrFirebase si falla por otro motivo.
+func LoginWithPassword(ctx context.Context, email, password string) (out LoginResp, err error) {
+	defer func() { countLogin(loginPassword, err) }()
+
+	apiKey := Current().FirebaseAPIKey
+	if apiKey == "" {
+		return out, errors.New("FIREBASE_API_KEY not configured")
+	}
+	url := "https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword?key=" + apiKey
+	reqBody := map[string]interface{}{
+		"email":             email,
+		"password":          password,
+		"returnSecureToken": true,
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+	fctx, span := firebaseSpan(ctx, "signInWithPassword")
+	req, err := http.NewRequestWithContext(fctx, http.MethodPost, url, bytes.NewReader(jsonBody))
+	if err != nil {
+		tracing.End(span, err)
+		return out, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tracing.End(span, err)
+		return out, fmt.Errorf("%w: %v", ErrFirebase, err)
+	}
+	defer resp.Body.Close()
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	span.End()
+	if resp.StatusCode != 200 {
+		return out, signInError(resp.StatusCode, bodyBytes)
+	}
+	var fbResp map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &fbResp); err != nil {
+		return out, fmt.Errorf("%w: respuesta inválida: %v", ErrFirebase, err)
+	}
+	idToken, _ := fbResp["idToken"].(string)
+	localId, _ := fbResp["localId"].(string)
+
+	// Optionally validate idToken with Admin SDK to ensure it's good (Firebase already issued it)
+	fctx, span = firebaseSpan(ctx, "VerifyIDToken")
+	_, verr := firebaseAuthClient.VerifyIDToken(fctx, idToken)
+	tracing.End(span, verr)
+
+	out, err = issueSession(ctx, localId)
 	if err != nil {
 		return out, err
 	}
+	out.FirebaseID = idToken
+	return out, nil
+}
+
+// signInError traduce el error de signInWithPassword. Solo los códigos que
+// dicen que email o password no coinciden son ErrInvalidCredentials.
+func signInError(status int, body []byte) error {
+	var fbErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &fbErr)
+	// Algunos traen detalle: "TOO_MANY_ATTEMPTS_TRY_LATER : Access to this account..."
+	code, _, _ := strings.Cut(fbErr.Error.Message, " ")
+	switch code {
+	case "INVALID_PASSWORD", "EMAIL_NOT_FOUND", "INVALID_LOGIN_CREDENTIALS":
+		return ErrInvalidCredentials
+	}
+	return fmt.Errorf("%w: status %d %s", ErrFirebase, status, fbErr.Error.Message)
+}
 
-	uid := fbTok.UID
+// RotateRefreshToken consume un refresh token (uso único) y emite una sesión
+// nueva. Si el token se acaba de rotar (refreshReuseGrace), devuelve la misma
+// sesión que obtuvo la primera petición en vez de rechazarlo.
+func RotateRefreshToken(ctx context.Context, token string) (LoginResp, error) {
+	var out LoginResp
+
+	refreshMu.Lock()
+	if rot, ok := rotations[token]; ok {
+		refreshMu.Unlock()
+		select {
+		case <-rot.done:
+			return rot.resp, rot.err
+		case <-ctx.Done():
+			return out, ctx.Err()
+		}
+	}
+	rt, ok := refreshStore[token]
+	if !ok {
+		refreshMu.Unlock()
+		return out, ErrRefreshInvalid
+	}
+	delete(refreshStore, token)
+	if time.Now().After(rt.ExpiresAt) {
+		refreshMu.Unlock()
+		return out, ErrRefreshExpired
+	}
+	rot := &rotation{done: make(chan struct{})}
+	rotations[token] = rot
+	refreshMu.Unlock()
 
-	access, err := generateRS256Token(uid, 30)
+	// issueSession puede ir a Firebase: las concurrentes esperan en rot.done
+	rot.resp, rot.err = issueSession(ctx, rt.UID)
+	close(rot.done)
+	time.AfterFunc(refreshReuseGrace, func() {
+		refreshMu.Lock()
+		delete(rotations, token)
+		refreshMu.Unlock()
+	})
+	return rot.resp, rot.err
+}
+
+// RevokeRefreshToken elimina un refresh token y devuelve el uid al que pertenecía.
+func RevokeRefreshToken(token string) string {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	rt := refreshStore[token]
+	delete(refreshStore, token)
+	delete(rotations, token)
+	return rt.UID
+}
+
+// issueSession genera access + refresh token para uid y registra el refresh.
+func issueSession(ctx context.Context, uid string) (LoginResp, error) {
+	var out LoginResp
+
+	st := Current()
+	access, err := generateRS256Token(ctx, uid, st.AccessTokenTTL)
 	if err != nil {
 		return out, err
 	}
@@ -434,7 +457,7 @@ func LoginWithIDToken(idToken string) (LoginResp, error) {
 	rt := RefreshToken{
 		Token:     refresh,
 		UID:       uid,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt: time.Now().Add(st.RefreshTokenTTL),
 		CreatedAt: time.Now(),
 	}
 
@@ -446,55 +469,32 @@ func LoginWithIDToken(idToken string) (LoginResp, error) {
 		AccessToken:  access,
 		RefreshToken: refresh,
 		UID:          uid,
+		ExpiresIn:    int(st.AccessTokenTTL.Seconds()),
 	}
 	return out, nil
 }
 
-// RegisterUser crea un usuario en Firebase y devuelve el UserRecord.
-// email/password son obligatorios.
-func RegisterUser(email, password string) (*firebaseAuth.UserRecord, error) {
-	if email == "" || password == "" {
-		return nil, errors.New("email y password requeridos")
-	}
-
-	params := (&firebaseAuth.UserToCreate{}).
-		Email(email).
-		Password(password)
-
-	u, err := firebaseAuthClient.CreateUser(context.Background(), params)
-	if err != nil {
-		return nil, err
-	}
-	return u, nil
+// createUserProblem traduce un error de CreateUser. El error crudo de Firebase
+// solo va al log.
+func createUserProblem(ctx context.Context, err error) (problem.Code, string) {
+	switch {
+	case firebaseAuth.IsEmailAlreadyExists(err):
+		return problem.EmailExists, ""
+	case firebaseAuth.IsInvalidEmail(err):
+		return problem.InvalidRequest, "detail.invalid_email"
+	case errorutils.IsUnavailable(err), errorutils.IsInternal(err), errorutils.IsUnknown(err):
+		slog.ErrorContext(ctx, "registro fallido", "error", err)
+		return problem.Internal, ""
+	}
+	// El resto son validaciones (p.ej. password de menos de 6 caracteres)
+	slog.WarnContext(ctx, "registro rechazado", "error", err)
+	return problem.InvalidRequest, "detail.weak_credentials"
 }
 
-// RegisterUserHTML maneja registro usando Gin + Templates HTML
-func RegisterUserHTML(c *gin.Context) {
-	email := c.PostForm("email")
-	password := c.PostForm("password")
-
-	if email == "" || password == "" {
-		c.HTML(http.StatusBadRequest, "register.html", gin.H{
-			"Error": "Todos los campos son obligatorios",
-		})
-		return
-	}
-
-	params := (&firebaseAuth.UserToCreate{}).
-		Email(email).
-		Password(password)
-
-	userRecord, err := firebaseAuthClient.CreateUser(context.Background(), params)
-	if err != nil {
-		c.HTML(http.StatusBadRequest, "register.html", gin.H{
-			"Error": fmt.Sprintf("Error creando usuario: %v", err),
-		})
-		return
+// refreshProblemDetail es el detalle de un refresh rechazado.
+func refreshProblemDetail(err error) string {
+	if errors.Is(err, ErrRefreshExpired) {
+		return "detail.refresh_expired"
 	}
-
-	c.HTML(http.StatusOK, "register.html", gin.H{
-		"Success": "Usuario creado correctamente. Ya puedes iniciar sesión.",
-	})
-
-	fmt.Println("Nuevo usuario Firebase:", userRecord.UID)
+	return "detail.refresh_invalid"
 }
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestSignInError(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		invalid bool
+	}{
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"INVALID_PASSWORD"}}`, true},
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"EMAIL_NOT_FOUND"}}`, true},
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"INVALID_LOGIN_CREDENTIALS"}}`, true},
+		// El resto no dice nada de las credenciales: no cuenta como intento fallido
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"TOO_MANY_ATTEMPTS_TRY_LATER : Access to this account has been temporarily disabled"}}`, false},
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"USER_DISABLED"}}`, false},
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"API key not valid. Please pass a valid API key."}}`, false},
+		{http.StatusServiceUnavailable, `<html>upstream</html>`, false},
+	}
+	for _, tt := range tests {
+		err := signInError(tt.status, []byte(tt.body))
+		if tt.invalid && !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%d %s: %v, se esperaba ErrInvalidCredentials", tt.status, tt.body, err)
+		}
+		if !tt.invalid && !errors.Is(err, ErrFirebase) {
+			t.Errorf("%d %s: %v, se esperaba ErrFirebase", tt.status, tt.body, err)
+		}
+	}
+}
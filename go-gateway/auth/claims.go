@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"gateway/tracing"
+)
+
+// RoleAdmin es el rol que habilita las rutas /admin/*.
+const RoleAdmin = "admin"
+
+// AccessClaims son los claims relevantes de un access token del gateway.
+type AccessClaims struct {
+	UID       string
+	Roles     []string
+	Scopes    []string
+	Actor     string // uid del admin que suplanta (claim "act"), vacío si no aplica
+	ExpiresAt time.Time
+}
+
+// HasRole indica si el token incluye el rol indicado.
+func (c *AccessClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope indica si el token incluye el scope indicado (claim "scope").
+func (c *AccessClaims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Impersonated indica si el token fue emitido por una suplantación de admin.
+func (c *AccessClaims) Impersonated() bool {
+	return c.Actor != ""
+}
+
+// ParseAccessToken verifica un access token RS256 del gateway y extrae sus claims.
+func ParseAccessToken(tokenStr string) (*AccessClaims, error) {
+	tok, err := VerifyRS256Token(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil || !tok.Valid {
+		return nil, errors.New("token inválido")
+	}
+	mc, ok := tok.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("claims inesperados")
+	}
+
+	out := &AccessClaims{}
+	out.UID, _ = mc["sub"].(string)
+	if out.UID == "" {
+		return nil, errors.New("token sin sub")
+	}
+	if exp, err := mc.GetExpirationTime(); err == nil && exp != nil {
+		out.ExpiresAt = exp.Time
+	}
+	if roles, ok := mc["roles"].([]interface{}); ok {
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				out.Roles = append(out.Roles, s)
+			}
+		}
+	}
+	if scope, ok := mc["scope"].(string); ok {
+		out.Scopes = strings.Fields(scope)
+	}
+	if act, ok := mc["act"].(map[string]interface{}); ok {
+		out.Actor, _ = act["sub"].(string)
+	}
+	return out, nil
+}
+
+// lookupRoles obtiene los roles del usuario desde sus custom claims de Firebase.
+// Acepta "roles": ["admin", ...] o el atajo "admin": true.
+func lookupRoles(ctx context.Context, uid string) []string {
+	if firebaseAuthClient == nil || uid == "" {
+		return []string{}
+	}
+	ctx, span := firebaseSpan(ctx, "GetUser")
+	u, err := firebaseAuthClient.GetUser(ctx, uid)
+	tracing.End(span, err)
+	if err != nil {
+		return []string{}
+	}
+	return rolesFromCustomClaims(u.CustomClaims)
+}
+
+func rolesFromCustomClaims(cc map[string]interface{}) []string {
+	roles := []string{}
+	if list, ok := cc["roles"].([]interface{}); ok {
+		for _, r := range list {
+			if s, ok := r.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+	}
+	if isAdmin, _ := cc["admin"].(bool); isAdmin {
+		found := false
+		for _, r := range roles {
+			if r == RoleAdmin {
+				found = true
+			}
+		}
+		if !found {
+			roles = append(roles, RoleAdmin)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gateway/config"
+)
+
+// CookiePolicy define los atributos de todas las cookies que escribe el gateway.
+type CookiePolicy struct {
+	Secure     bool
+	SameSite   http.SameSite
+	Domain     string
+	Path       string
+	HostPrefix bool // usa los prefijos __Host- / __Secure- en los nombres
+}
+
+// refreshCookiePath limita la cookie de refresh a la ruta /refresh.
+const refreshCookiePath = "/refresh"
+
+// DefaultCookiePolicy es la política usada si no hay configuración.
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+}
+
+// CookiePolicyFromConfig construye y valida la política a partir de la config.
+func CookiePolicyFromConfig(cfg config.CookieConfig) (CookiePolicy, error) {
+	ss, err := ParseSameSite(cfg.SameSite)
+	if err != nil {
+		return CookiePolicy{}, err
+	}
+	p := CookiePolicy{
+		Secure:     cfg.Secure,
+		SameSite:   ss,
+		Domain:     cfg.Domain,
+		Path:       cfg.Path,
+		HostPrefix: cfg.HostPrefix,
+	}
+	return p, p.Validate()
+}
+
+// ParseSameSite convierte "lax", "strict" o "none" al valor de net/http.
+func ParseSameSite(v string) (http.SameSite, error) {
+	switch strings.ToLower(v) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, errors.New("SameSite inválido: " + v)
+}
+
+// Validate comprueba las restricciones que imponen los navegadores.
+func (p CookiePolicy) Validate() error {
+	if p.SameSite == http.SameSiteNoneMode && !p.Secure {
+		return errors.New("SameSite=None requiere Secure")
+	}
+	if p.HostPrefix {
+		if !p.Secure {
+			return errors.New("el prefijo __Host- requiere Secure")
+		}
+		if p.Path != "/" || p.Domain != "" {
+			return errors.New("el prefijo __Host- requiere Path=/ y sin Domain")
+		}
+	}
+	if !strings.HasPrefix(p.Path, "/") {
+		return errors.New("el path de las cookies debe empezar con /")
+	}
+	return nil
+}
+
+// Nombres de cookie según la política
+func AccessCookieName() string {
+	if Current().Cookies.HostPrefix {
+		return "__Host-access_token"
+	}
+	return "access_token"
+}
+
+// La de suplantación va aparte de la propia: al terminar se borra y el admin
+// sigue con su sesión
+func ImpersonationCookieName() string {
+	if Current().Cookies.HostPrefix {
+		return "__Host-impersonation_token"
+	}
+	return "impersonation_token"
+}
+
+// La de refresh no puede usar __Host- porque su Path no es "/"
+func RefreshCookieName() string {
+	if Current().Cookies.HostPrefix {
+		return "__Secure-refresh_token"
+	}
+	return "refresh_token"
+}
+
+func CSRFCookieName() string {
+	if Current().Cookies.HostPrefix {
+		return "__Host-csrf_token"
+	}
+	return "csrf_token"
+}
+
+// La de idioma guarda la preferencia del usuario; no es de sesión
+func LangCookieName() string {
+	if Current().Cookies.HostPrefix {
+		return "__Host-lang"
+	}
+	return "lang"
+}
+
+// langCookieMaxAge: la preferencia de idioma dura un año.
+const langCookieMaxAge = 365 * 24 * 60 * 60
+
+// SetSessionCookies escribe access + refresh token de una sesión recién emitida.
+// Una sesión nueva (login o refresh) termina cualquier suplantación: el token
+// suplantado no se renueva.
+func SetSessionCookies(w http.ResponseWriter, resp LoginResp) {
+	st := Current()
+	SetAccessCookie(w, resp.AccessToken, st.AccessTokenTTL)
+	writeCookie(w, RefreshCookieName(), resp.RefreshToken, refreshCookiePath, int(st.RefreshTokenTTL.Seconds()), true, st.Cookies.SameSite)
+	ClearImpersonationCookie(w)
+}
+
+// SetAccessCookie escribe solo el access token.
+func SetAccessCookie(w http.ResponseWriter, token string, ttl time.Duration) {
+	p := Current().Cookies
+	writeCookie(w, AccessCookieName(), token, p.Path, int(ttl.Seconds()), true, p.SameSite)
+}
+
+// SetImpersonationCookie escribe el token de una suplantación sin tocar la
+// sesión del admin, que sigue en sus cookies de access y refresh.
+func SetImpersonationCookie(w http.ResponseWriter, token string, ttl time.Duration) {
+	p := Current().Cookies
+	writeCookie(w, ImpersonationCookieName(), token, p.Path, int(ttl.Seconds()), true, p.SameSite)
+}
+
+// ClearImpersonationCookie termina la suplantación en el navegador.
+func ClearImpersonationCookie(w http.ResponseWriter) {
+	p := Current().Cookies
+	writeCookie(w, ImpersonationCookieName(), "", p.Path, -1, true, p.SameSite)
+}
+
+// ClearSessionCookies borra access y refresh token (y la suplantación) del navegador.
+func ClearSessionCookies(w http.ResponseWriter) {
+	p := Current().Cookies
+	writeCookie(w, AccessCookieName(), "", p.Path, -1, true, p.SameSite)
+	writeCookie(w, RefreshCookieName(), "", refreshCookiePath, -1, true, p.SameSite)
+	ClearImpersonationCookie(w)
+}
+
+// SetCSRFCookie escribe el token CSRF. Es legible desde JS y siempre Strict.
+func SetCSRFCookie(w http.ResponseWriter, token string) {
+	writeCookie(w, CSRFCookieName(), token, Current().Cookies.Path, 0, false, http.SameSiteStrictMode)
+}
+
+// SetLangCookie recuerda el idioma elegido. Sobrevive al logout.
+func SetLangCookie(w http.ResponseWriter, lang string) {
+	p := Current().Cookies
+	writeCookie(w, LangCookieName(), lang, p.Path, langCookieMaxAge, true, p.SameSite)
+}
+
+// AccessTokenFromCookie devuelve el token con el que actúa el navegador: el
+// de la suplantación si hay una en curso, si no el propio.
+func AccessTokenFromCookie(r *http.Request) string {
+	if token := cookieValue(r, ImpersonationCookieName()); token != "" {
+		return token
+	}
+	return cookieValue(r, AccessCookieName())
+}
+
+func RefreshTokenFromCookie(r *http.Request) string {
+	return cookieValue(r, RefreshCookieName())
+}
+
+func CSRFTokenFromCookie(r *http.Request) string {
+	return cookieValue(r, CSRFCookieName())
+}
+
+func LangFromCookie(r *http.Request) string {
+	return cookieValue(r, LangCookieName())
+}
+
+func cookieValue(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func writeCookie(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool, sameSite http.SameSite) {
+	p := Current().Cookies
+	domain := p.Domain
+	if p.HostPrefix && strings.HasPrefix(name, "__Host-") {
+		domain = ""
+		path = "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   domain,
+		MaxAge:   maxAge,
+		Secure:   p.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cookiesSet devuelve las cookies de la respuesta por nombre.
+func cookiesSet(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	out := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		out[c.Name] = c
+	}
+	return out
+}
+
+func TestImpersonationCookieKeepsAdminSession(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetImpersonationCookie(w, "suplantado", time.Minute)
+	set := cookiesSet(w)
+	if _, ok := set[AccessCookieName()]; ok {
+		t.Fatal("empezar una suplantación no debe reescribir la cookie de acceso del admin")
+	}
+	if c := set[ImpersonationCookieName()]; c == nil || c.Value != "suplantado" || !c.HttpOnly {
+		t.Fatalf("cookie de suplantación = %+v", c)
+	}
+
+	// Con las dos, actúa la suplantación; sin ella, la sesión propia
+	r := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	r.AddCookie(&http.Cookie{Name: AccessCookieName(), Value: "admin"})
+	r.AddCookie(&http.Cookie{Name: ImpersonationCookieName(), Value: "suplantado"})
+	if got := AccessTokenFromCookie(r); got != "suplantado" {
+		t.Errorf("AccessTokenFromCookie = %q, se esperaba el token suplantado", got)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	r.AddCookie(&http.Cookie{Name: AccessCookieName(), Value: "admin"})
+	if got := AccessTokenFromCookie(r); got != "admin" {
+		t.Errorf("AccessTokenFromCookie = %q, se esperaba el token del admin", got)
+	}
+}
+
+func TestEndingImpersonationOnlyClearsItsCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	ClearImpersonationCookie(w)
+	set := cookiesSet(w)
+	if len(set) != 1 || set[ImpersonationCookieName()] == nil || set[ImpersonationCookieName()].MaxAge >= 0 {
+		t.Fatalf("cookies = %+v, se esperaba solo borrar la de suplantación", set)
+	}
+}
+
+func TestNewSessionEndsImpersonation(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(http.ResponseWriter)
+	}{
+		{"login o refresh", func(w http.ResponseWriter) { SetSessionCookies(w, LoginResp{AccessToken: "a", RefreshToken: "r"}) }},
+		{"logout", ClearSessionCookies},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.write(w)
+			if c := cookiesSet(w)[ImpersonationCookieName()]; c == nil || c.MaxAge >= 0 {
+				t.Errorf("la cookie de suplantación debía borrarse: %+v", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	firebaseAuth "firebase.google.com/go/v4/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"gateway/tracing"
+)
+
+var (
+	// ErrInvalidImpersonation es una suplantación que no tiene sentido (sin
+	// uid, o a uno mismo)
+	ErrInvalidImpersonation = errors.New("suplantación inválida")
+	ErrImpersonationNoUID   = fmt.Errorf("%w: uid requerido", ErrInvalidImpersonation)
+	ErrSelfImpersonation    = fmt.Errorf("%w: no puedes suplantarte a ti mismo", ErrInvalidImpersonation)
+	ErrUserNotFound         = errors.New("usuario no encontrado")
+)
+
+// Impersonate emite un access token para targetUID en nombre de adminUID.
+// El token lleva los roles del usuario suplantado y el claim "act" (RFC 8693)
+// identificando al admin. Su vida (ImpersonationTTL) es corta a propósito: no se
+// emite refresh token para estas sesiones.
+func Impersonate(ctx context.Context, adminUID, targetUID string) (string, error) {
+	if adminUID == "" || targetUID == "" {
+		return "", ErrImpersonationNoUID
+	}
+	if adminUID == targetUID {
+		return "", ErrSelfImpersonation
+	}
+	ctx, span := firebaseSpan(ctx, "GetUser")
+	u, err := firebaseAuthClient.GetUser(ctx, targetUID)
+	tracing.End(span, err)
+	if firebaseAuth.IsUserNotFound(err) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return signAccessToken(u.UID, Current().ImpersonationTTL, jwt.MapClaims{
+		"roles": rolesFromCustomClaims(u.CustomClaims),
+		"act":   map[string]interface{}{"sub": adminUID},
+	})
+}
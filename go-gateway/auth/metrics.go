@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"gateway/metrics"
+)
+
+// Formas de login (label method de gateway_logins_total).
+const (
+	loginIDToken  = "id_token"
+	loginPassword = "password"
+)
+
+var logins = metrics.NewCounterVec("gateway_logins_total",
+	"Logins por forma y resultado: success, failure (credenciales o idToken rechazados) o error.", "method", "result")
+
+func countLogin(method string, err error) {
+	switch {
+	case err == nil:
+		logins.Inc(method, "success")
+	case errors.Is(err, ErrInvalidCredentials):
+		logins.Inc(method, "failure")
+	default:
+		logins.Inc(method, "error")
+	}
+}
+
+func init() {
+	metrics.NewGaugeFunc("gateway_refresh_tokens_active", "Refresh tokens emitidos y todavía vigentes.", nil, func(emit metrics.Emit) {
+		emit(float64(activeRefreshTokens()))
+	})
+}
+
+// activeRefreshTokens cuenta los refresh tokens no vencidos ni revocados.
+func activeRefreshTokens() int {
+	now := time.Now()
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	n := 0
+	for _, rt := range refreshStore {
+		if now.Before(rt.ExpiresAt) {
+			n++
+		}
+	}
+	return n
+}
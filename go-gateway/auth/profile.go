@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"gateway/i18n"
+	"gateway/tracing"
+)
+
+// Profile es la información del usuario que muestran el dashboard y GET /me.
+type Profile struct {
+	UID            string   `json:"uid"`
+	Name           string   `json:"name"`
+	Email          string   `json:"email"`
+	Roles          []string `json:"roles"`
+	Zones          []string `json:"zones"`
+	Lang           string   `json:"lang,omitempty"`
+	ImpersonatedBy string   `json:"impersonated_by,omitempty"`
+}
+
+type cachedProfile struct {
+	uid       string
+	profile   Profile
+	expiresAt time.Time
+}
+
+// profileCacheMax acota la caché: pasado el máximo se descartan los perfiles
+// menos consultados (LRU).
+const profileCacheMax = 10000
+
+var (
+	profileMu    sync.Mutex
+	profileLRU   = list.New() // de *cachedProfile; frente = consultado más recientemente
+	profileCache = map[string]*list.Element{}
+)
+
+// cachedLookup devuelve el perfil de uid si está en caché y no venció.
+func cachedLookup(uid string) (Profile, bool) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	el, ok := profileCache[uid]
+	if !ok {
+		return Profile{}, false
+	}
+	cp := el.Value.(*cachedProfile)
+	if !time.Now().Before(cp.expiresAt) {
+		profileLRU.Remove(el)
+		delete(profileCache, uid)
+		return Profile{}, false
+	}
+	profileLRU.MoveToFront(el)
+	return cp.profile, true
+}
+
+// cacheProfile guarda el perfil de uid y descarta del fondo los vencidos y lo que sobre del máximo.
+func cacheProfile(uid string, p Profile) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	now := time.Now()
+	cp := &cachedProfile{uid: uid, profile: p, expiresAt: now.Add(Current().ProfileCacheTTL)}
+	if el, ok := profileCache[uid]; ok {
+		el.Value = cp
+		profileLRU.MoveToFront(el)
+	} else {
+		profileCache[uid] = profileLRU.PushFront(cp)
+	}
+	for el := profileLRU.Back(); el != nil; el = profileLRU.Back() {
+		old := el.Value.(*cachedProfile)
+		if now.Before(old.expiresAt) && profileLRU.Len() <= profileCacheMax {
+			return
+		}
+		profileLRU.Remove(el)
+		delete(profileCache, old.uid)
+	}
+}
+
+// forgetProfile saca a uid de la caché (p.ej. tras cambiarle los claims).
+func forgetProfile(uid string) {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	if el, ok := profileCache[uid]; ok {
+		profileLRU.Remove(el)
+		delete(profileCache, uid)
+	}
+}
+
+// LookupProfile devuelve el perfil de uid desde Firebase, con caché en memoria.
+// Las zonas permitidas salen del custom claim "zones": ["A", "B", ...] y el
+// idioma preferido del claim "lang".
+func LookupProfile(ctx context.Context, uid string) (Profile, error) {
+	if p, ok := cachedLookup(uid); ok {
+		return p, nil
+	}
+
+	ctx, span := firebaseSpan(ctx, "GetUser")
+	u, err := firebaseAuthClient.GetUser(ctx, uid)
+	tracing.End(span, err)
+	if err != nil {
+		return Profile{}, err
+	}
+	p := Profile{
+		UID:   u.UID,
+		Name:  u.DisplayName,
+		Email: u.Email,
+		Roles: rolesFromCustomClaims(u.CustomClaims),
+		Zones: []string{},
+	}
+	if zones, ok := u.CustomClaims["zones"].([]interface{}); ok {
+		for _, z := range zones {
+			if s, ok := z.(string); ok && s != "" {
+				p.Zones = append(p.Zones, s)
+			}
+		}
+	}
+
+	if lang, ok := u.CustomClaims["lang"].(string); ok {
+		p.Lang, _ = i18n.Parse(lang)
+	}
+
+	cacheProfile(uid, p)
+	return p, nil
+}
+
+// SetLanguage guarda lang como idioma preferido de uid (custom claim "lang"),
+// conservando el resto de custom claims.
+func SetLanguage(ctx context.Context, uid, lang string) error {
+	gctx, span := firebaseSpan(ctx, "GetUser")
+	u, err := firebaseAuthClient.GetUser(gctx, uid)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	claims := map[string]interface{}{}
+	for k, v := range u.CustomClaims {
+		claims[k] = v
+	}
+	claims["lang"] = lang
+	sctx, span := firebaseSpan(ctx, "SetCustomUserClaims")
+	err = firebaseAuthClient.SetCustomUserClaims(sctx, uid, claims)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+
+	forgetProfile(uid)
+	return nil
+}
+
+// ProfileFor arma el perfil de la sesión: datos de Firebase más los roles y la
+// suplantación tal como vienen en el token validado.
+func ProfileFor(ctx context.Context, claims *AccessClaims) (Profile, error) {
+	p, err := LookupProfile(ctx, claims.UID)
+	if err != nil {
+		return Profile{}, err
+	}
+	p.Roles = claims.Roles
+	if p.Roles == nil {
+		p.Roles = []string{}
+	}
+	p.ImpersonatedBy = claims.Actor
+	return p, nil
+}
+
+// DisplayName es el nombre a mostrar: nombre, o email si no hay nombre.
+func (p Profile) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if p.Email != "" {
+		return p.Email
+	}
+	return p.UID
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gateway/config"
+)
+
+// Settings agrupa la configuración de auth que puede cambiar en caliente. Cada
+// petición lee un puntero inmutable, así que un reload nunca la deja a medias.
+type Settings struct {
+	Cookies          CookiePolicy
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	ImpersonationTTL time.Duration
+	ProfileCacheTTL  time.Duration
+	FirebaseAPIKey   string
+}
+
+var settings atomic.Pointer[Settings]
+
+func init() {
+	d := config.Default()
+	settings.Store(&Settings{
+		Cookies:          DefaultCookiePolicy(),
+		AccessTokenTTL:   d.Auth.AccessTokenTTL,
+		RefreshTokenTTL:  d.Auth.RefreshTokenTTL,
+		ImpersonationTTL: d.Auth.ImpersonationTTL,
+		ProfileCacheTTL:  d.Auth.ProfileCacheTTL,
+	})
+}
+
+// Current devuelve la configuración de auth activa.
+func Current() *Settings {
+	return settings.Load()
+}
+
+// Configure valida y aplica la configuración de autenticación y cookies.
+func Configure(cfg config.AuthConfig, cookies config.CookieConfig) error {
+	policy, err := CookiePolicyFromConfig(cookies)
+	if err != nil {
+		return err
+	}
+	settings.Store(&Settings{
+		Cookies:          policy,
+		AccessTokenTTL:   cfg.AccessTokenTTL,
+		RefreshTokenTTL:  cfg.RefreshTokenTTL,
+		ImpersonationTTL: cfg.ImpersonationTTL,
+		ProfileCacheTTL:  cfg.ProfileCacheTTL,
+		FirebaseAPIKey:   cfg.FirebaseAPIKey,
+	})
+	return nil
+}
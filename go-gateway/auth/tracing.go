@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("gateway/auth")
+
+// firebaseSpan abre el span de cliente de una llamada a Firebase (op es la
+// operación, p.ej. "GetUser"); se cierra con tracing.End.
+func firebaseSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "firebase "+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.PeerService("firebase"),
+		attribute.String("firebase.operation", op),
+	))
+}
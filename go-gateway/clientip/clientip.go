@@ -0,0 +1,167 @@
+// Package clientip obtiene la IP del cliente. Los headers que la informan
+// (X-Forwarded-For, Forwarded, X-Real-IP) solo se creen si la conexión viene de
+// un proxy de confianza, y se recorren de derecha a izquierda: cada proxy
+// agrega al final, así que lo que está a la izquierda del primer salto que no
+// es de confianza lo pudo escribir el cliente.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"gateway/config"
+)
+
+type resolver struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+var current atomic.Pointer[resolver]
+
+// Configure aplica la lista de proxies de confianza (se puede volver a llamar
+// al recargar la config). Los CIDRs ya vienen validados.
+func Configure(cfg config.ClientIPConfig) {
+	res := &resolver{header: cfg.Header}
+	for _, s := range cfg.TrustedProxies {
+		if p, err := config.ParsePrefix(s); err == nil {
+			res.trusted = append(res.trusted, p)
+		}
+	}
+	current.Store(res)
+}
+
+// FromRequest devuelve la IP del cliente de r. Sin proxies de confianza es la
+// IP de la conexión.
+func FromRequest(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	client := peer.Unmap()
+
+	res := current.Load()
+	if res == nil || !res.trusts(client) {
+		return client.String()
+	}
+
+	var hops []string
+	switch res.header {
+	case config.HeaderForwarded:
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	case config.HeaderXRealIP:
+		if v := r.Header.Values("X-Real-IP"); len(v) > 0 {
+			hops = v[len(v)-1:]
+		}
+	default:
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseHop(hops[i])
+		if !ok {
+			// "unknown", un identificador ofuscado o basura: no se puede
+			// seguir, el cliente es el último salto conocido
+			break
+		}
+		client = ip
+		if !res.trusts(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (res *resolver) trusts(ip netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop acepta "ip", "ip:puerto", "[ipv6]" y "[ipv6]:puerto".
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if ip, err := netip.ParseAddr(s); err == nil {
+		return ip.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		if ip, err := netip.ParseAddr(s[1 : len(s)-1]); err == nil {
+			return ip.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// -------------------------
+// Forwarded (RFC 7239)
+// -------------------------
+// Forwarded: for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8::1]:4711"
+// Cada elemento (separado por coma) es un salto; de cada uno interesa el
+// parámetro for. Un elemento sin for cuenta como salto desconocido.
+
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, elem := range splitQuoted(v, ',') {
+			if strings.TrimSpace(elem) == "" {
+				continue
+			}
+			hop := ""
+			for _, pair := range splitQuoted(elem, ';') {
+				k, val, ok := strings.Cut(pair, "=")
+				if ok && strings.EqualFold(strings.TrimSpace(k), "for") {
+					hop = unquote(strings.TrimSpace(val))
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// splitQuoted separa s por sep fuera de las comillas.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gateway/config"
+)
+
+// nginx y el balanceador son de confianza; 203.0.113.0/24 es internet.
+var trusted = []string{"10.0.0.1", "172.16.0.0/12"}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string // client_ip.header
+		trusted []string
+		remote  string
+		values  map[string][]string
+		want    string
+	}{
+		{
+			name:   "sin proxies de confianza vale la conexión",
+			remote: "203.0.113.7:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "conexión que no es de confianza", trusted: trusted,
+			remote: "203.0.113.7:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "un salto", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "lo que escribió el cliente a la izquierda no cuenta", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7, 172.16.5.5"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "varios headers se leen como uno", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.7", "172.16.5.5"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "todos de confianza: el primero", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"172.16.0.9, 172.16.5.5"}},
+			want:   "172.16.0.9",
+		},
+		{
+			name: "un salto ilegible corta la cadena", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4, unknown, 172.16.5.5"}},
+			want:   "172.16.5.5",
+		},
+		{
+			name: "puertos e IPv6", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"[2001:db8::1]:4711"}},
+			want:   "2001:db8::1",
+		},
+		{
+			name: "IPv4 mapeada en IPv6", trusted: trusted,
+			remote: "[::ffff:10.0.0.1]:4000",
+			values: map[string][]string{"X-Forwarded-For": {"::ffff:203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "sin header vale la conexión", trusted: trusted,
+			remote: "10.0.0.1:4000",
+			want:   "10.0.0.1",
+		},
+		{
+			name: "con forwarded se ignora X-Forwarded-For", header: config.HeaderForwarded, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name: "forwarded", header: config.HeaderForwarded, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"Forwarded": {`for=1.2.3.4, for=203.0.113.7;proto=https;by=10.0.0.1, For="172.16.5.5"`}},
+			want:   "203.0.113.7",
+		},
+		{
+			name: "forwarded con IPv6 y comas entre comillas", header: config.HeaderForwarded, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"Forwarded": {`for="[2001:db8::1]:4711";by="a,b"`}},
+			want:   "2001:db8::1",
+		},
+		{
+			name: "forwarded: un salto sin for corta la cadena", header: config.HeaderForwarded, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"Forwarded": {"for=203.0.113.7, proto=https"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name: "forwarded: identificador ofuscado", header: config.HeaderForwarded, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"Forwarded": {`for=203.0.113.7, for="_hidden"`}},
+			want:   "10.0.0.1",
+		},
+		{
+			name: "x-real-ip: el último", header: config.HeaderXRealIP, trusted: trusted,
+			remote: "10.0.0.1:4000",
+			values: map[string][]string{"X-Real-Ip": {"1.2.3.4", "203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = config.HeaderXForwardedFor
+			}
+			Configure(config.ClientIPConfig{TrustedProxies: tt.trusted, Header: header})
+			t.Cleanup(func() { Configure(config.ClientIPConfig{}) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, vs := range tt.values {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
+			if got := FromRequest(req); got != tt.want {
+				t.Errorf("FromRequest = %s, se esperaba %s", got, tt.want)
+			}
+		})
+	}
+}
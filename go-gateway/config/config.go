@@ -0,0 +1,1130 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Config es la configuración completa del gateway.
+// Precedencia: flags > variables de entorno > archivo YAML > valores por defecto.
+type Config struct {
+	Server    ServerConfig              `yaml:"server"`
+	Upstreams map[string]UpstreamConfig `yaml:"upstreams"`
+	Routes    []RouteConfig             `yaml:"routes"`
+	// RetryBudget limita los reintentos de todas las rutas juntas
+	RetryBudget RetryBudgetConfig `yaml:"retry_budget"`
+	// Concurrency limita las peticiones en curso de todas las rutas juntas
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Auth        AuthConfig        `yaml:"auth"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Cookies     CookieConfig      `yaml:"cookies"`
+	Audit       AuditConfig       `yaml:"audit"`
+	ClientIP    ClientIPConfig    `yaml:"client_ip"`
+	IPFilter    IPFilterConfig    `yaml:"ip_filter"`
+	Log         LogConfig         `yaml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+
+	// Source es el archivo del que se leyó la config ("" si no hubo archivo)
+	Source string `yaml:"-"`
+}
+
+type ServerConfig struct {
+	Addr          string `yaml:"addr"`
+	StaticDir     string `yaml:"static_dir"`
+	TemplatesGlob string `yaml:"templates_glob"`
+	// Cada cuánto se revisa el archivo de config para recargarlo
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// UpstreamConfig es un servicio interno al que el gateway reenvía tráfico,
+// con una o varias instancias.
+type UpstreamConfig struct {
+	// URL es el atajo para una sola instancia (equivale a un target de peso 1)
+	URL     string         `yaml:"url"`
+	Targets []TargetConfig `yaml:"targets"`
+	// Strategy: round_robin (por defecto), least_connections o consistent_hash
+	Strategy string `yaml:"strategy"`
+
+	HealthCheck    HealthCheckConfig    `yaml:"health_check"`
+	Passive        PassiveHealthConfig  `yaml:"passive"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+}
+
+// HealthCheckConfig es el chequeo activo: un GET periódico a Path en cada
+// instancia. Sin Path no hay chequeo activo y las instancias se consideran sanas.
+type HealthCheckConfig struct {
+	Path     string        `yaml:"path"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// Chequeos consecutivos para pasar a sana / no sana
+	HealthyThreshold   int `yaml:"healthy_threshold"`
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+}
+
+// PassiveHealthConfig es la expulsión pasiva: tras ConsecutiveFailures
+// respuestas 5xx o errores de conexión seguidos la instancia sale del balanceo
+// durante EjectionTime y luego vuelve sola.
+type PassiveHealthConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	EjectionTime        time.Duration `yaml:"ejection_time"`
+}
+
+// TargetConfig es una instancia de un upstream.
+type TargetConfig struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// CircuitBreakerConfig corta el tráfico a un upstream entero cuando falla o se
+// vuelve lento: el circuito se abre si en Window hubo al menos MinRequests y la
+// tasa de errores (5xx o sin respuesta) o de llamadas más lentas que
+// SlowCallDuration supera su umbral. Abierto responde 503 sin llamar al
+// upstream durante OpenDuration; después deja pasar HalfOpenRequests de prueba
+// y, si todas salen bien, vuelve a cerrarse.
+type CircuitBreakerConfig struct {
+	Disabled         bool          `yaml:"disabled"`
+	Window           time.Duration `yaml:"window"`
+	MinRequests      int           `yaml:"min_requests"`
+	ErrorRate        float64       `yaml:"error_rate"`
+	SlowCallDuration time.Duration `yaml:"slow_call_duration"`
+	SlowCallRate     float64       `yaml:"slow_call_rate"`
+	OpenDuration     time.Duration `yaml:"open_duration"`
+	HalfOpenRequests int           `yaml:"half_open_requests"`
+}
+
+// Estrategias de balanceo
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastConnections = "least_connections"
+	StrategyConsistentHash   = "consistent_hash"
+)
+
+// AllTargets devuelve las instancias del upstream, incluida la de URL, con
+// peso 1 cuando no se indicó.
+func (u UpstreamConfig) AllTargets() []TargetConfig {
+	var out []TargetConfig
+	if u.URL != "" {
+		out = append(out, TargetConfig{URL: u.URL, Weight: 1})
+	}
+	for _, t := range u.Targets {
+		if t.Weight == 0 {
+			t.Weight = 1
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// RouteConfig es una entrada de la tabla de rutas: todo lo que empiece por
+// Prefix se reenvía a Upstream.
+type RouteConfig struct {
+	Name     string `yaml:"name"`
+	Prefix   string `yaml:"prefix"`
+	Upstream string `yaml:"upstream"`
+	// Rewrite reemplaza el prefijo en el path reenviado ("/python-api" -> "/api")
+	Rewrite string `yaml:"rewrite"`
+	// StripPrefix quita el prefijo del path reenviado (ignorado si hay Rewrite)
+	StripPrefix bool `yaml:"strip_prefix"`
+	// Public desactiva la exigencia de access token
+	Public bool     `yaml:"public"`
+	Roles  []string `yaml:"roles"`
+	Scopes []string `yaml:"scopes"`
+	// Timeout total de la petición al upstream (0 = sin límite)
+	Timeout time.Duration `yaml:"timeout"`
+	// ConnectTimeout limita el establecimiento de la conexión y
+	// ResponseHeaderTimeout la espera de los headers de respuesta
+	ConnectTimeout        time.Duration `yaml:"connect_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	// RateLimits son las políticas de rate_limit.policies que se aplican a la
+	// ruta en lugar del límite general por IP. RateLimitClass es la forma vieja
+	// (una sola) y se suma a RateLimits.
+	RateLimitClass string                 `yaml:"rate_limit_class"`
+	RateLimits     []string               `yaml:"rate_limits"`
+	Retry          RetryConfig            `yaml:"retry"`
+	Concurrency    RouteConcurrencyConfig `yaml:"concurrency"`
+}
+
+// RetryConfig son los reintentos de una ruta. Solo se reintentan métodos
+// idempotentes, o POST/PATCH con header Idempotency-Key, y solo si el cuerpo
+// cabe en MaxBodyBytes (hay que guardarlo para reenviarlo).
+type RetryConfig struct {
+	// Attempts es el total de intentos, incluido el primero (1 = sin reintentos)
+	Attempts int `yaml:"attempts"`
+	// Espera antes del reintento n: aleatoria entre 0 y min(Backoff*2^n, MaxBackoff)
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// OnStatus son respuestas del upstream que también se reintentan (p.ej. 503);
+	// los errores de conexión se reintentan siempre
+	OnStatus     []int `yaml:"on_status"`
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// RetryBudgetConfig evita tormentas de reintentos: en los últimos 10s no se
+// reintenta más que Ratio de las peticiones, salvo un mínimo de MinPerSecond.
+type RetryBudgetConfig struct {
+	Ratio        float64 `yaml:"ratio"`
+	MinPerSecond int     `yaml:"min_per_second"`
+}
+
+// Clases de prioridad: al saturarse se descarta primero lo de menor prioridad.
+const (
+	PriorityCritical = "critical"
+	PriorityHigh     = "high"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
+)
+
+// ConcurrencyConfig es el límite global de peticiones en curso hacia los
+// upstreams, con una cola de espera acotada. MaxInFlight 0 = sin límite.
+type ConcurrencyConfig struct {
+	MaxInFlight int `yaml:"max_in_flight"`
+	// QueueSize peticiones esperan hasta QueueTimeout a que se libere lugar
+	QueueSize    int           `yaml:"queue_size"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// Priorities asigna la clase de cada petición (la primera regla que
+	// coincide); sin regla es "normal"
+	Priorities []PriorityRule `yaml:"priorities"`
+}
+
+// PriorityRule da la clase Priority a las peticiones que coinciden con Paths
+// (patrones como los de ip_filter) y, si se indican, con Methods.
+type PriorityRule struct {
+	Priority string   `yaml:"priority"`
+	Paths    []string `yaml:"paths"`
+	Methods  []string `yaml:"methods"`
+}
+
+// RouteConcurrencyConfig es el límite de peticiones en curso de una ruta.
+type RouteConcurrencyConfig struct {
+	MaxInFlight  int            `yaml:"max_in_flight"`
+	QueueSize    int            `yaml:"queue_size"`
+	QueueTimeout time.Duration  `yaml:"queue_timeout"`
+	Adaptive     AdaptiveConfig `yaml:"adaptive"`
+}
+
+// AdaptiveConfig ajusta el límite de la ruta entre MinLimit y MaxInFlight
+// (AIMD): si una respuesta tarda más que Latency o falla, lo multiplica por
+// Backoff (como mucho una vez cada Latency); si no, lo sube de a poco.
+type AdaptiveConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	MinLimit int           `yaml:"min_limit"`
+	Latency  time.Duration `yaml:"latency"`
+	Backoff  float64       `yaml:"backoff"`
+}
+
+type AuthConfig struct {
+	ServiceAccountPath string        `yaml:"service_account_path"`
+	FirebaseAPIKey     string        `yaml:"firebase_api_key" json:"-"`
+	AccessTokenTTL     time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL    time.Duration `yaml:"refresh_token_ttl"`
+	ImpersonationTTL   time.Duration `yaml:"impersonation_ttl"`
+	ProfileCacheTTL    time.Duration `yaml:"profile_cache_ttl"`
+}
+
+type RateLimitConfig struct {
+	// Algorithm: token_bucket (admite ráfagas de hasta Burst) o sliding_log
+	// (nunca más de N en cualquier ventana de un minuto)
+	Algorithm         string `yaml:"algorithm"`
+	RequestsPerMinute int    `yaml:"requests_per_minute"`
+	// Burst es la capacidad del token bucket; 0 = requests_per_minute
+	Burst int `yaml:"burst"`
+	// Classes son políticas abreviadas: peticiones por minuto por IP
+	Classes  map[string]int             `yaml:"classes"`
+	Policies map[string]RateLimitPolicy `yaml:"policies"`
+	// Endpoints aplica políticas a rutas propias del gateway (path exacto),
+	// p.ej. "/login-basic": [login]
+	Endpoints map[string][]string  `yaml:"endpoints"`
+	Store     RateLimitStoreConfig `yaml:"store"`
+}
+
+// RateLimitPolicy es un límite con nombre: Requests por Period, contados por
+// la clave que arma Key. Con varias partes (p.ej. [sub, route]) cada
+// combinación tiene su propia cuota.
+type RateLimitPolicy struct {
+	Requests  int           `yaml:"requests"`
+	Period    time.Duration `yaml:"period"`
+	Burst     int           `yaml:"burst"`
+	Algorithm string        `yaml:"algorithm"`
+	Key       []string      `yaml:"key"`
+}
+
+// Partes de la clave de una política. Si la petición no trae sub, api_key o
+// device_id, esa parte se reemplaza por la IP (los anónimos no comparten cuota).
+const (
+	KeyIP       = "ip"        // IP real del cliente
+	KeySub      = "sub"       // usuario del access token
+	KeyAPIKey   = "api_key"   // header X-API-Key
+	KeyDeviceID = "device_id" // dispositivo (X-Device-ID, query o path)
+	KeyRoute    = "route"     // ruta de la tabla (o path del endpoint)
+)
+
+// Algoritmos de rate limit
+const (
+	AlgorithmTokenBucket = "token_bucket"
+	AlgorithmSlidingLog  = "sliding_log"
+)
+
+// RateLimitStoreConfig indica dónde viven los contadores: en memoria (por
+// réplica) o en un servidor Redis compartido por todas las réplicas.
+type RateLimitStoreConfig struct {
+	Backend string `yaml:"backend"`
+	// MaxKeys acota la memoria: se descartan las claves menos usadas (LRU)
+	MaxKeys int                  `yaml:"max_keys"`
+	Redis   RateLimitRedisConfig `yaml:"redis"`
+}
+
+// Backends de rate limit
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+type RateLimitRedisConfig struct {
+	Addr     string        `yaml:"addr"`
+	Password string        `yaml:"password" json:"-"`
+	DB       int           `yaml:"db"`
+	Prefix   string        `yaml:"prefix"`
+	Timeout  time.Duration `yaml:"timeout"`
+	PoolSize int           `yaml:"pool_size"`
+}
+
+type CookieConfig struct {
+	Secure     bool   `yaml:"secure"`
+	SameSite   string `yaml:"same_site"`
+	Domain     string `yaml:"domain"`
+	Path       string `yaml:"path"`
+	HostPrefix bool   `yaml:"host_prefix"`
+}
+
+type AuditConfig struct {
+	Path string `yaml:"path"`
+}
+
+// Niveles y formatos de log (LogConfig).
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+
+	LogJSON = "json"
+	LogText = "text"
+)
+
+// LogConfig es el log de la aplicación y de accesos (log/slog).
+type LogConfig struct {
+	// Level: debug, info (por defecto), warn o error
+	Level string `yaml:"level"`
+	// Format: json (por defecto) o text
+	Format string `yaml:"format"`
+}
+
+// Exportadores de trazas (TracingConfig.Exporter).
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+	TracingFile   = "file"
+)
+
+// TracingConfig es el trazado distribuido con OpenTelemetry. Solo SampleRate
+// se recarga en caliente; el resto requiere reinicio.
+type TracingConfig struct {
+	// Exporter: none (por defecto), otlp (OTLP/HTTP), stdout o file
+	Exporter string `yaml:"exporter"`
+	// Endpoint del colector OTLP/HTTP, p.ej. http://otel-collector:4318 (sin
+	// path va a /v1/traces; http:// sin TLS). Vacío = localhost:4318
+	Endpoint string `yaml:"endpoint"`
+	// File recibe las trazas en JSON con exporter file
+	File string `yaml:"file"`
+	// SampleRate es la fracción de trazas nuevas que se registran (0 a 1); si
+	// la petición ya viene con traceparent se respeta la decisión del llamador
+	SampleRate  float64 `yaml:"sample_rate"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// IPFilterConfig restringe el acceso según la IP del cliente (ver ClientIP).
+// Las listas son CIDRs o IPs sueltas.
+type IPFilterConfig struct {
+	// Deny se rechaza en todo el gateway
+	Deny []string `yaml:"deny"`
+	// Groups restringe grupos de rutas (p.ej. /admin/* solo desde la planta)
+	Groups map[string]IPFilterGroup `yaml:"groups"`
+	Ban    BanConfig                `yaml:"ban"`
+}
+
+// IPFilterGroup aplica Allow/Deny a las peticiones cuyo path coincide con
+// Paths. Un path termina en "/*" para incluir todo lo que cuelga de él, y un
+// "*" intermedio es un segmento cualquiera ("/api/actuadores/*/activar").
+type IPFilterGroup struct {
+	Paths []string `yaml:"paths"`
+	// Methods limita el grupo a esos métodos (vacío = todos), p.ej. para
+	// restringir los comandos y dejar públicas las lecturas
+	Methods []string `yaml:"methods"`
+	// Allow vacío = cualquier IP que no esté en Deny
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// BanConfig banea temporalmente una IP al llegar a RateLimited rechazos por
+// rate limit o a LoginFailures logins fallidos dentro de Window (0 = no se
+// banea por ese motivo).
+type BanConfig struct {
+	Duration      time.Duration `yaml:"duration"`
+	Window        time.Duration `yaml:"window"`
+	RateLimited   int           `yaml:"rate_limited"`
+	LoginFailures int           `yaml:"login_failures"`
+	// Exempt son redes que nunca se banean (la planta, los proxies)
+	Exempt []string `yaml:"exempt"`
+}
+
+// Headers de los que se puede sacar la IP del cliente (ClientIPConfig.Header).
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderForwarded     = "forwarded"
+	HeaderXRealIP       = "x-real-ip"
+)
+
+// ClientIPConfig define de qué proxies se aceptan los headers con la IP del
+// cliente. Sin TrustedProxies se ignoran y vale la IP de la conexión.
+type ClientIPConfig struct {
+	// TrustedProxies son CIDRs o IPs sueltas (nginx, balanceador)
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Header: x-forwarded-for (por defecto), forwarded (RFC 7239) o x-real-ip.
+	// Tiene que ser el que escribe el proxy: los demás los controla el cliente.
+	Header string `yaml:"header"`
+}
+
+// Default devuelve los valores que el gateway usaba antes de ser configurable.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:           ":8081",
+			StaticDir:      "./static",
+			TemplatesGlob:  "templates/*.html",
+			ReloadInterval: 5 * time.Second,
+		},
+		Upstreams: map[string]UpstreamConfig{
+			// Spring Boot tarda en arrancar: no recibe tráfico hasta que
+			// /actuator/health responde
+			"java": {
+				URL:         "http://java-service:8080",
+				HealthCheck: HealthCheckConfig{Path: "/actuator/health"},
+			},
+			"python": {
+				URL:         "http://python-service:8000",
+				HealthCheck: HealthCheckConfig{Path: "/health"},
+			},
+		},
+		Routes: []RouteConfig{
+			{Name: "java", Prefix: "/api", Upstream: "java"},
+			// Igual que nginx: /python-api/x -> /api/x
+			{Name: "python", Prefix: "/python-api", Upstream: "python", Rewrite: "/api"},
+		},
+		Auth: AuthConfig{
+			ServiceAccountPath: "serviceAccountKey.json",
+			AccessTokenTTL:     30 * time.Minute,
+			RefreshTokenTTL:    7 * 24 * time.Hour,
+			ImpersonationTTL:   15 * time.Minute,
+			ProfileCacheTTL:    5 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute: 60,
+		},
+		Cookies: CookieConfig{
+			SameSite: "lax",
+			Path:     "/",
+		},
+		Audit: AuditConfig{
+			Path: "audit.log",
+		},
+		Tracing: TracingConfig{
+			// En el archivo, sample_rate: 0 apaga el muestreo
+			SampleRate: 1,
+		},
+	}
+}
+
+// Load arma la configuración a partir de los argumentos de línea de comandos
+// (sin el nombre del programa), el entorno y el archivo indicado por -config o
+// GATEWAY_CONFIG.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("GATEWAY_CONFIG"), "archivo de configuración YAML")
+	addr := fs.String("addr", "", "dirección de escucha (p.ej. :8081)")
+	javaURL := fs.String("java-url", "", "URL del java-service")
+	pythonURL := fs.String("python-url", "", "URL del python-service")
+	saPath := fs.String("service-account", "", "ruta del serviceAccountKey.json")
+	accessTTL := fs.Duration("access-ttl", 0, "vida del access token")
+	refreshTTL := fs.Duration("refresh-ttl", 0, "vida del refresh token")
+	rpm := fs.Int("rate-limit", 0, "peticiones por minuto por IP")
+	auditPath := fs.String("audit-log", "", "archivo del log de auditoría")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		if err := loadFile(cfg, *configPath); err != nil {
+			return nil, err
+		}
+		cfg.Source = *configPath
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	// Solo los flags que se pasaron explícitamente pisan lo anterior
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = *addr
+		case "java-url":
+			cfg.setUpstreamURL("java", *javaURL)
+		case "python-url":
+			cfg.setUpstreamURL("python", *pythonURL)
+		case "service-account":
+			cfg.Auth.ServiceAccountPath = *saPath
+		case "access-ttl":
+			cfg.Auth.AccessTokenTTL = *accessTTL
+		case "refresh-ttl":
+			cfg.Auth.RefreshTokenTTL = *refreshTTL
+		case "rate-limit":
+			cfg.RateLimit.RequestsPerMinute = *rpm
+		case "audit-log":
+			cfg.Audit.Path = *auditPath
+		}
+	})
+
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile aplica el archivo YAML sobre los valores actuales.
+func loadFile(cfg *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("leyendo config %s: %w", path, err)
+	}
+	if err := yaml.UnmarshalWithOptions(b, cfg, yaml.Strict()); err != nil {
+		return fmt.Errorf("config %s inválida: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv aplica las variables de entorno (incluidas las que ya define docker-compose).
+func applyEnv(cfg *Config) error {
+	str := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	var errs []error
+	dur := func(key string, dst *time.Duration) {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s inválido: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v := os.Getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s inválido: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("GATEWAY_ADDR", &cfg.Server.Addr)
+	if v := os.Getenv("JAVA_SERVICE_URL"); v != "" {
+		cfg.setUpstreamURL("java", v)
+	}
+	if v := os.Getenv("PYTHON_SERVICE_URL"); v != "" {
+		cfg.setUpstreamURL("python", v)
+	}
+	str("SERVICE_ACCOUNT_PATH", &cfg.Auth.ServiceAccountPath)
+	str("FIREBASE_API_KEY", &cfg.Auth.FirebaseAPIKey)
+	dur("ACCESS_TOKEN_TTL", &cfg.Auth.AccessTokenTTL)
+	dur("REFRESH_TOKEN_TTL", &cfg.Auth.RefreshTokenTTL)
+	dur("IMPERSONATION_TTL", &cfg.Auth.ImpersonationTTL)
+	if v := os.Getenv("RATE_LIMIT_RPM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("RATE_LIMIT_RPM inválido: %w", err))
+		} else {
+			cfg.RateLimit.RequestsPerMinute = n
+		}
+	}
+	str("RATE_LIMIT_BACKEND", &cfg.RateLimit.Store.Backend)
+	str("RATE_LIMIT_REDIS_ADDR", &cfg.RateLimit.Store.Redis.Addr)
+	str("RATE_LIMIT_REDIS_PASSWORD", &cfg.RateLimit.Store.Redis.Password)
+	boolean("COOKIE_SECURE", &cfg.Cookies.Secure)
+	str("COOKIE_SAMESITE", &cfg.Cookies.SameSite)
+	str("COOKIE_DOMAIN", &cfg.Cookies.Domain)
+	str("COOKIE_PATH", &cfg.Cookies.Path)
+	boolean("COOKIE_HOST_PREFIX", &cfg.Cookies.HostPrefix)
+	str("AUDIT_LOG_PATH", &cfg.Audit.Path)
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	str("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	if v := os.Getenv("TRACING_SAMPLE_RATE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TRACING_SAMPLE_RATE inválido: %w", err))
+		} else {
+			cfg.Tracing.SampleRate = f
+		}
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.ClientIP.TrustedProxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.ClientIP.TrustedProxies = append(cfg.ClientIP.TrustedProxies, p)
+			}
+		}
+	}
+	str("CLIENT_IP_HEADER", &cfg.ClientIP.Header)
+
+	return errors.Join(errs...)
+}
+
+// setUpstreamURL reemplaza las instancias de un upstream (creándolo si no
+// existe). Acepta varias URLs separadas por coma.
+func (c *Config) setUpstreamURL(name, raw string) {
+	if c.Upstreams == nil {
+		c.Upstreams = map[string]UpstreamConfig{}
+	}
+	up := c.Upstreams[name]
+	up.URL = ""
+	up.Targets = nil
+	for _, u := range strings.Split(raw, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			up.Targets = append(up.Targets, TargetConfig{URL: u, Weight: 1})
+		}
+	}
+	c.Upstreams[name] = up
+}
+
+// setDefaults completa los valores omitidos de upstreams, rutas y reintentos,
+// así una entrada declarada en el archivo solo necesita lo que cambia.
+func (c *Config) setDefaults() {
+	for name, up := range c.Upstreams {
+		hc := &up.HealthCheck
+		if hc.Interval == 0 {
+			hc.Interval = 10 * time.Second
+		}
+		if hc.Timeout == 0 {
+			hc.Timeout = 2 * time.Second
+		}
+		if hc.HealthyThreshold == 0 {
+			hc.HealthyThreshold = 2
+		}
+		if hc.UnhealthyThreshold == 0 {
+			hc.UnhealthyThreshold = 3
+		}
+		if up.Passive.ConsecutiveFailures == 0 {
+			up.Passive.ConsecutiveFailures = 5
+		}
+		if up.Passive.EjectionTime == 0 {
+			up.Passive.EjectionTime = 30 * time.Second
+		}
+		cb := &up.CircuitBreaker
+		if cb.Window == 0 {
+			cb.Window = 10 * time.Second
+		}
+		if cb.MinRequests == 0 {
+			cb.MinRequests = 20
+		}
+		if cb.ErrorRate == 0 {
+			cb.ErrorRate = 0.5
+		}
+		if cb.SlowCallDuration == 0 {
+			cb.SlowCallDuration = 5 * time.Second
+		}
+		if cb.SlowCallRate == 0 {
+			cb.SlowCallRate = 0.5
+		}
+		if cb.OpenDuration == 0 {
+			cb.OpenDuration = 30 * time.Second
+		}
+		if cb.HalfOpenRequests == 0 {
+			cb.HalfOpenRequests = 5
+		}
+		c.Upstreams[name] = up
+	}
+
+	for i := range c.Routes {
+		if c.Routes[i].ConnectTimeout == 0 {
+			c.Routes[i].ConnectTimeout = 5 * time.Second
+		}
+		if c.Routes[i].ResponseHeaderTimeout == 0 {
+			c.Routes[i].ResponseHeaderTimeout = 30 * time.Second
+		}
+		rt := &c.Routes[i].Retry
+		if rt.Attempts == 0 {
+			rt.Attempts = 3
+		}
+		if rt.Backoff == 0 {
+			rt.Backoff = 50 * time.Millisecond
+		}
+		if rt.MaxBackoff == 0 {
+			rt.MaxBackoff = time.Second
+		}
+		if rt.MaxBodyBytes == 0 {
+			rt.MaxBodyBytes = 64 << 10
+		}
+		cc := &c.Routes[i].Concurrency
+		if cc.QueueTimeout == 0 {
+			cc.QueueTimeout = time.Second
+		}
+		if cc.Adaptive.MinLimit == 0 {
+			cc.Adaptive.MinLimit = 1
+		}
+		if cc.Adaptive.Latency == 0 {
+			cc.Adaptive.Latency = time.Second
+		}
+		if cc.Adaptive.Backoff == 0 {
+			cc.Adaptive.Backoff = 0.9
+		}
+	}
+
+	rl := &c.RateLimit
+	if rl.Algorithm == "" {
+		rl.Algorithm = AlgorithmTokenBucket
+	}
+	if len(rl.Classes) > 0 && rl.Policies == nil {
+		rl.Policies = map[string]RateLimitPolicy{}
+	}
+	for name, rpm := range rl.Classes {
+		if _, ok := rl.Policies[name]; !ok {
+			rl.Policies[name] = RateLimitPolicy{Requests: rpm, Key: []string{KeyIP}}
+		}
+	}
+	for name, p := range rl.Policies {
+		if p.Period == 0 {
+			p.Period = time.Minute
+		}
+		if p.Algorithm == "" {
+			p.Algorithm = rl.Algorithm
+		}
+		if len(p.Key) == 0 {
+			p.Key = []string{KeyIP}
+		}
+		rl.Policies[name] = p
+	}
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if r.RateLimitClass != "" && !slices.Contains(r.RateLimits, r.RateLimitClass) {
+			r.RateLimits = append(r.RateLimits, r.RateLimitClass)
+		}
+	}
+	if rl.Store.Backend == "" {
+		rl.Store.Backend = BackendMemory
+	}
+	if rl.Store.MaxKeys == 0 {
+		rl.Store.MaxKeys = 100000
+	}
+	if rl.Store.Redis.Prefix == "" {
+		rl.Store.Redis.Prefix = "gateway:rl:"
+	}
+	if rl.Store.Redis.Timeout == 0 {
+		rl.Store.Redis.Timeout = 200 * time.Millisecond
+	}
+	if rl.Store.Redis.PoolSize == 0 {
+		rl.Store.Redis.PoolSize = 16
+	}
+
+	if c.IPFilter.Ban.Duration == 0 {
+		c.IPFilter.Ban.Duration = 15 * time.Minute
+	}
+	if c.IPFilter.Ban.Window == 0 {
+		c.IPFilter.Ban.Window = 5 * time.Minute
+	}
+	for _, g := range c.IPFilter.Groups {
+		upper(g.Methods)
+	}
+
+	if c.Log.Level == "" {
+		c.Log.Level = LogInfo
+	}
+	if c.Log.Format == "" {
+		c.Log.Format = LogJSON
+	}
+	c.Log.Level = strings.ToLower(c.Log.Level)
+	c.Log.Format = strings.ToLower(c.Log.Format)
+
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = TracingNone
+	}
+	c.Tracing.Exporter = strings.ToLower(c.Tracing.Exporter)
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "go-gateway"
+	}
+
+	if c.ClientIP.Header == "" {
+		c.ClientIP.Header = HeaderXForwardedFor
+	}
+	c.ClientIP.Header = strings.ToLower(c.ClientIP.Header)
+
+	if c.Concurrency.QueueTimeout == 0 {
+		c.Concurrency.QueueTimeout = time.Second
+	}
+	for i := range c.Concurrency.Priorities {
+		upper(c.Concurrency.Priorities[i].Methods)
+	}
+
+	if c.RetryBudget.Ratio == 0 {
+		c.RetryBudget.Ratio = 0.2
+	}
+	if c.RetryBudget.MinPerSecond == 0 {
+		c.RetryBudget.MinPerSecond = 5
+	}
+}
+
+// Validate revisa que la configuración sea coherente antes de usarla.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr requerido"))
+	}
+	if c.Server.ReloadInterval <= 0 {
+		errs = append(errs, errors.New("server.reload_interval debe ser positivo"))
+	}
+	for name, up := range c.Upstreams {
+		targets := up.AllTargets()
+		if len(targets) == 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s: se requiere url o targets", name))
+		}
+		for _, t := range targets {
+			u, err := url.Parse(t.URL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("upstreams.%s: %q no es una URL válida", name, t.URL))
+			}
+			if t.Weight < 0 {
+				errs = append(errs, fmt.Errorf("upstreams.%s: peso negativo para %s", name, t.URL))
+			}
+		}
+		switch up.Strategy {
+		case "", StrategyRoundRobin, StrategyLeastConnections, StrategyConsistentHash:
+		default:
+			errs = append(errs, fmt.Errorf("upstreams.%s: strategy %q desconocida", name, up.Strategy))
+		}
+		hc := up.HealthCheck
+		if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+			errs = append(errs, fmt.Errorf("upstreams.%s.health_check.path debe empezar con /", name))
+		}
+		if hc.Interval <= 0 || hc.Timeout <= 0 || hc.HealthyThreshold <= 0 || hc.UnhealthyThreshold <= 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.health_check: intervalos y umbrales deben ser positivos", name))
+		}
+		if up.Passive.ConsecutiveFailures <= 0 || up.Passive.EjectionTime <= 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.passive: valores deben ser positivos", name))
+		}
+		cb := up.CircuitBreaker
+		if cb.Window < time.Second {
+			errs = append(errs, fmt.Errorf("upstreams.%s.circuit_breaker.window debe ser de al menos 1s", name))
+		}
+		if cb.MinRequests <= 0 || cb.SlowCallDuration <= 0 || cb.OpenDuration <= 0 || cb.HalfOpenRequests <= 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.circuit_breaker: duraciones y cantidades deben ser positivas", name))
+		}
+		if cb.ErrorRate <= 0 || cb.ErrorRate > 1 || cb.SlowCallRate <= 0 || cb.SlowCallRate > 1 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.circuit_breaker: las tasas deben estar en (0, 1]", name))
+		}
+	}
+	seen := map[string]bool{}
+	for i, r := range c.Routes {
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: name requerido", i))
+		} else if seen[r.Name] {
+			errs = append(errs, fmt.Errorf("routes[%d]: name %q repetido", i, r.Name))
+		}
+		seen[r.Name] = true
+		if !strings.HasPrefix(r.Prefix, "/") {
+			errs = append(errs, fmt.Errorf("routes.%s: prefix debe empezar con /", r.Name))
+		}
+		if r.Rewrite != "" && !strings.HasPrefix(r.Rewrite, "/") {
+			errs = append(errs, fmt.Errorf("routes.%s: rewrite debe empezar con /", r.Name))
+		}
+		if _, ok := c.Upstreams[r.Upstream]; !ok {
+			errs = append(errs, fmt.Errorf("routes.%s: upstream %q no definido", r.Name, r.Upstream))
+		}
+		if r.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("routes.%s: timeout negativo", r.Name))
+		}
+		if r.ConnectTimeout <= 0 || r.ResponseHeaderTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("routes.%s: connect_timeout y response_header_timeout deben ser positivos", r.Name))
+		}
+		if r.Retry.Attempts <= 0 || r.Retry.Backoff <= 0 || r.Retry.MaxBackoff < r.Retry.Backoff || r.Retry.MaxBodyBytes < 0 {
+			errs = append(errs, fmt.Errorf("routes.%s.retry: attempts y backoff deben ser positivos y max_backoff >= backoff", r.Name))
+		}
+		for _, code := range r.Retry.OnStatus {
+			if code < 500 || code > 599 {
+				errs = append(errs, fmt.Errorf("routes.%s.retry.on_status: %d no es un 5xx", r.Name, code))
+			}
+		}
+		for _, name := range r.RateLimits {
+			if _, ok := c.RateLimit.Policies[name]; !ok {
+				errs = append(errs, fmt.Errorf("routes.%s: política de rate limit %q no definida", r.Name, name))
+			}
+		}
+		cc := r.Concurrency
+		if cc.MaxInFlight < 0 || cc.QueueSize < 0 || cc.QueueTimeout < 0 {
+			errs = append(errs, fmt.Errorf("routes.%s.concurrency: valores no pueden ser negativos", r.Name))
+		}
+		if a := cc.Adaptive; a.Enabled {
+			if cc.MaxInFlight == 0 {
+				errs = append(errs, fmt.Errorf("routes.%s.concurrency.adaptive requiere max_in_flight", r.Name))
+			}
+			if a.MinLimit <= 0 || a.MinLimit > cc.MaxInFlight || a.Latency <= 0 || a.Backoff <= 0 || a.Backoff >= 1 {
+				errs = append(errs, fmt.Errorf("routes.%s.concurrency.adaptive: min_limit en [1, max_in_flight], latency positiva y backoff en (0, 1)", r.Name))
+			}
+		}
+	}
+	cc := c.Concurrency
+	if cc.MaxInFlight < 0 || cc.QueueSize < 0 || cc.QueueTimeout < 0 {
+		errs = append(errs, errors.New("concurrency: valores no pueden ser negativos"))
+	}
+	for i, rule := range cc.Priorities {
+		switch rule.Priority {
+		case PriorityCritical, PriorityHigh, PriorityNormal, PriorityLow:
+		default:
+			errs = append(errs, fmt.Errorf("concurrency.priorities[%d]: prioridad %q desconocida", i, rule.Priority))
+		}
+		if len(rule.Paths) == 0 {
+			errs = append(errs, fmt.Errorf("concurrency.priorities[%d]: se requiere paths", i))
+		}
+		for _, p := range rule.Paths {
+			if !strings.HasPrefix(p, "/") {
+				errs = append(errs, fmt.Errorf("concurrency.priorities[%d]: path %q debe empezar con /", i, p))
+			}
+		}
+	}
+	if c.RetryBudget.Ratio <= 0 || c.RetryBudget.Ratio > 1 || c.RetryBudget.MinPerSecond < 0 {
+		errs = append(errs, errors.New("retry_budget: ratio debe estar en (0, 1] y min_per_second no puede ser negativo"))
+	}
+	if c.Auth.ServiceAccountPath == "" {
+		errs = append(errs, errors.New("auth.service_account_path requerido"))
+	}
+	if c.Auth.AccessTokenTTL <= 0 || c.Auth.RefreshTokenTTL <= 0 || c.Auth.ImpersonationTTL <= 0 {
+		errs = append(errs, errors.New("las duraciones de token deben ser positivas"))
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refresh_token_ttl debe ser mayor que auth.access_token_ttl"))
+	}
+	if c.RateLimit.RequestsPerMinute <= 0 {
+		errs = append(errs, errors.New("rate_limit.requests_per_minute debe ser positivo"))
+	}
+	for name, rpm := range c.RateLimit.Classes {
+		if rpm <= 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.classes.%s debe ser positivo", name))
+		}
+	}
+	switch c.RateLimit.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmSlidingLog:
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.algorithm inválido: %q", c.RateLimit.Algorithm))
+	}
+	for name, p := range c.RateLimit.Policies {
+		if p.Requests <= 0 || p.Period <= 0 || p.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s: requests y period deben ser positivos y burst no negativo", name))
+		}
+		switch p.Algorithm {
+		case AlgorithmTokenBucket, AlgorithmSlidingLog:
+		default:
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s: algorithm inválido: %q", name, p.Algorithm))
+		}
+		for _, k := range p.Key {
+			switch k {
+			case KeyIP, KeySub, KeyAPIKey, KeyDeviceID, KeyRoute:
+			default:
+				errs = append(errs, fmt.Errorf("rate_limit.policies.%s: parte de clave inválida: %q", name, k))
+			}
+		}
+	}
+	for path, names := range c.RateLimit.Endpoints {
+		for _, name := range names {
+			if _, ok := c.RateLimit.Policies[name]; !ok {
+				errs = append(errs, fmt.Errorf("rate_limit.endpoints.%s: política %q no definida", path, name))
+			}
+		}
+	}
+	if c.RateLimit.Burst < 0 {
+		errs = append(errs, errors.New("rate_limit.burst no puede ser negativo"))
+	}
+	st := c.RateLimit.Store
+	switch st.Backend {
+	case BackendMemory:
+		if st.MaxKeys < 0 {
+			errs = append(errs, errors.New("rate_limit.store.max_keys no puede ser negativo"))
+		}
+	case BackendRedis:
+		if st.Redis.Addr == "" {
+			errs = append(errs, errors.New("rate_limit.store.redis.addr requerido"))
+		}
+		if st.Redis.Timeout < 0 || st.Redis.PoolSize < 0 || st.Redis.DB < 0 {
+			errs = append(errs, errors.New("rate_limit.store.redis: timeout, pool_size y db no pueden ser negativos"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.store.backend inválido: %q", st.Backend))
+	}
+	switch strings.ToLower(c.Cookies.SameSite) {
+	case "lax", "strict", "none":
+	default:
+		errs = append(errs, fmt.Errorf("cookies.same_site inválido: %q", c.Cookies.SameSite))
+	}
+	if c.Audit.Path == "" {
+		errs = append(errs, errors.New("audit.path requerido"))
+	}
+	for _, p := range c.ClientIP.TrustedProxies {
+		if _, err := ParsePrefix(p); err != nil {
+			errs = append(errs, fmt.Errorf("client_ip.trusted_proxies: %w", err))
+		}
+	}
+	switch c.ClientIP.Header {
+	case HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP:
+	default:
+		errs = append(errs, fmt.Errorf("client_ip.header inválido: %q", c.ClientIP.Header))
+	}
+	switch c.Log.Level {
+	case LogDebug, LogInfo, LogWarn, LogError:
+	default:
+		errs = append(errs, fmt.Errorf("log.level inválido: %q", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case LogJSON, LogText:
+	default:
+		errs = append(errs, fmt.Errorf("log.format inválido: %q", c.Log.Format))
+	}
+	tr := c.Tracing
+	switch tr.Exporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if tr.Endpoint != "" {
+			if u, err := url.Parse(tr.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("tracing.endpoint inválido: %q (se espera http(s)://host:puerto)", tr.Endpoint))
+			}
+		}
+	case TracingFile:
+		if tr.File == "" {
+			errs = append(errs, errors.New("tracing.file requerido con exporter file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter inválido: %q", tr.Exporter))
+	}
+	if tr.SampleRate < 0 || tr.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_rate debe estar entre 0 y 1: %v", tr.SampleRate))
+	}
+	ipf := c.IPFilter
+	cidrs := func(field string, list []string) {
+		for _, p := range list {
+			if _, err := ParsePrefix(p); err != nil {
+				errs = append(errs, fmt.Errorf("ip_filter.%s: %w", field, err))
+			}
+		}
+	}
+	cidrs("deny", ipf.Deny)
+	cidrs("ban.exempt", ipf.Ban.Exempt)
+	for name, g := range ipf.Groups {
+		if len(g.Paths) == 0 {
+			errs = append(errs, fmt.Errorf("ip_filter.groups.%s: se requiere paths", name))
+		}
+		for _, p := range g.Paths {
+			if !strings.HasPrefix(p, "/") {
+				errs = append(errs, fmt.Errorf("ip_filter.groups.%s: path %q debe empezar con /", name, p))
+			}
+		}
+		cidrs("groups."+name+".allow", g.Allow)
+		cidrs("groups."+name+".deny", g.Deny)
+	}
+	if ipf.Ban.Duration < 0 || ipf.Ban.Window < 0 || ipf.Ban.RateLimited < 0 || ipf.Ban.LoginFailures < 0 {
+		errs = append(errs, errors.New("ip_filter.ban: valores no pueden ser negativos"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// MatchPath indica si path coincide con pattern: "*" es un segmento
+// cualquiera y, al final, también todo lo que sigue (incluido nada:
+// "/admin/*" cubre "/admin"). urlPath se normaliza antes, como lo haría el
+// backend: se quitan los parámetros de segmento (";x") y se resuelven "//",
+// "." y ".." ("/a;x/../b" = "/b"). Se espera el path ya decodificado
+// (URL.Path), así "%3B" y "%2e%2e" cuentan igual que ";" y "..".
+func MatchPath(pattern, urlPath string) bool {
+	pat := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(cleanPath(urlPath), "/"), "/")
+	for i, p := range pat {
+		if p == "*" && i == len(pat)-1 {
+			return len(segs) >= i
+		}
+		if i >= len(segs) || (p != "*" && p != segs[i]) {
+			return false
+		}
+	}
+	return len(segs) == len(pat)
+}
+
+// cleanPath quita los parámetros de cada segmento y normaliza el resultado.
+// Los parámetros se quitan primero porque hay servidores que leen "..;x" como "..".
+func cleanPath(urlPath string) string {
+	segs := strings.Split(urlPath, "/")
+	for i, seg := range segs {
+		if j := strings.IndexByte(seg, ';'); j >= 0 {
+			segs[i] = seg[:j]
+		}
+	}
+	return path.Clean("/" + strings.Join(segs, "/"))
+}
+
+// MatchMethod indica si method está en methods (vacío = todos).
+func MatchMethod(methods []string, method string) bool {
+	return len(methods) == 0 || slices.Contains(methods, method)
+}
+
+func upper(list []string) {
+	for i, s := range list {
+		list[i] = strings.ToUpper(s)
+	}
+}
+
+// ParsePrefix acepta un CIDR ("10.0.0.0/8") o una IP suelta (= /32 o /128).
+// Las IPv4 escritas como IPv6 (::ffff:a.b.c.d) se normalizan a IPv4.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q no es una IP ni un CIDR", s)
+		}
+		ip = ip.Unmap()
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q no es una IP ni un CIDR", s)
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		uri     string // como llega en la petición; se compara su URL.Path
+		want    bool
+	}{
+		{"/api/actuadores/*", "/api/actuadores/5/activar", true},
+		{"/api/actuadores/*", "/api/actuadores", true},
+		{"/api/actuadores/*", "/api/actuadoresx/5", false},
+		{"/api/actuadores/*", "/api/sensores/5", false},
+		{"/api/*/estado", "/api/5/estado", true},
+		{"/api/*/estado", "/api/5/estado/x", false},
+
+		// "//", "/./" y ".." se resuelven como en el backend
+		{"/api/actuadores/*", "//api//actuadores/5", true},
+		{"/api/actuadores/*", "/api/./actuadores/5", true},
+		{"/api/actuadores/*", "/api/x/../actuadores/5", true},
+		{"/api/actuadores/*", "/api/actuadores/../sensores/5", false},
+		{"/admin/*", "/../admin", true},
+
+		// Parámetros de segmento: no cambian a qué ruta se llega
+		{"/api/actuadores/*", "/api/actuadores;x/5/activar", true},
+		{"/api/actuadores/*", "/api;jsessionid=1/actuadores/5", true},
+		{"/api/actuadores/*", "/api/x/..;y/actuadores/5", true},
+		{"/admin/*", "/admin;x", true},
+		{"/admin/*", "/;x/admin/usuarios", true},
+
+		// Codificados: URL.Path ya viene decodificado
+		{"/api/actuadores/*", "/api/actuadores%3Bx/5/activar", true},
+		{"/api/actuadores/*", "/api/actuadores%3bx/5", true},
+		{"/api/actuadores/*", "/api%2Factuadores/5", true},
+		{"/api/actuadores/*", "/api/x/%2e%2e/actuadores/5", true},
+		{"/api/actuadores/*", "/api/%2E/actuadores/5", true},
+	}
+	for _, tt := range tests {
+		u, err := url.ParseRequestURI(tt.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.uri, err)
+		}
+		if got := MatchPath(tt.pattern, u.Path); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, se esperaba %v", tt.pattern, u.Path, got, tt.want)
+		}
+	}
+}
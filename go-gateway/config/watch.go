@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Watch recarga la configuración cuando cambia el archivo source (revisado cada
+// interval) o cuando el proceso recibe SIGHUP, y entrega la nueva config a
+// apply. Si la carga o apply fallan se registra el error y la config anterior
+// sigue activa.
+func Watch(ctx context.Context, args []string, source string, interval time.Duration, apply func(*Config) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMod := modTime(source)
+
+	reload := func(reason string) {
+		cfg, err := Load(args)
+		if err != nil {
+			slog.Error("config: recarga rechazada", "reason", reason, "error", err)
+			return
+		}
+		if err := apply(cfg); err != nil {
+			slog.Error("config: recarga no aplicada", "reason", reason, "error", err)
+			return
+		}
+		slog.Info("config: recarga aplicada", "reason", reason)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			lastMod = modTime(source)
+			reload("SIGHUP")
+		case <-ticker.C:
+			if source == "" {
+				continue
+			}
+			if m := modTime(source); !m.Equal(lastMod) {
+				lastMod = m
+				reload("archivo modificado")
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"gateway/auth"
+	"gateway/middleware"
+	"gateway/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyHandler atiende cualquier ruta de la tabla declarativa del snapshot
+// vigente: autenticación, roles/scopes, políticas de rate limit y reenvío.
+// Se registra como NoRoute, así que las rutas propias del gateway tienen
+// prioridad.
+func ProxyHandler(c *gin.Context) {
+
+	snap := Current()
+	route := snap.Routes.Match(c.Request.URL.Path)
+	if route == nil || len(route.Config.RateLimits) == 0 {
+		// Sin políticas propias cuenta el límite general, antes de autenticar
+		if !middleware.AllowGlobal(c) {
+			problem.Abort(c, problem.RateLimited, "")
+			return
+		}
+	}
+	if route == nil {
+		problem.Abort(c, problem.NotFound, "")
+		return
+	}
+	rc := route.Config
+	c.Set(middleware.RouteKey, rc.Name)
+	c.Set(middleware.UpstreamKey, rc.Upstream)
+
+	var claims *auth.AccessClaims
+	if !rc.Public {
+		claims = middleware.SessionClaims(c)
+		if claims == nil {
+			if middleware.UsesBearer(c) {
+				problem.Abort(c, problem.InvalidToken, "")
+				return
+			}
+			middleware.RedirectToSilentRefresh(c)
+			return
+		}
+		for _, role := range rc.Roles {
+			if !claims.HasRole(role) {
+				problem.Abort(c, problem.Forbidden, "detail.requires_role", role)
+				return
+			}
+		}
+		for _, scope := range rc.Scopes {
+			if !claims.HasScope(scope) {
+				problem.Abort(c, problem.Forbidden, "detail.requires_scope", scope)
+				return
+			}
+		}
+		c.Set(middleware.ClaimsKey, claims)
+	}
+
+	if !middleware.AllowPolicies(c, rc.RateLimits, rc.Name, claims) {
+		problem.Abort(c, problem.RateLimited, "")
+		return
+	}
+
+	route.ServeHTTP(c.Writer, c.Request)
+}
+
+// IsProxiedPath indica si path lo atiende alguna ruta de la tabla vigente.
+func IsProxiedPath(path string) bool {
+	return Current().Routes.Match(path) != nil
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"gateway/metrics"
+	"gateway/proxy"
+)
+
+// -------------------------
+// Métricas del snapshot vigente
+// -------------------------
+// El estado de los upstreams y de los límites de concurrencia se lee en cada
+// scrape de la tabla activa, la misma que muestra /admin/upstreams.
+
+var breakerStates = []string{proxy.BreakerClosed, proxy.BreakerOpen, proxy.BreakerHalfOpen}
+
+func init() {
+	pools := func(fn func(proxy.PoolStatus)) {
+		if snap := Current(); snap != nil {
+			for _, p := range snap.Routes.Status() {
+				fn(p)
+			}
+		}
+	}
+	limiters := func(fn func(proxy.LimiterStatus)) {
+		fn(proxy.GlobalConcurrency())
+		if snap := Current(); snap != nil {
+			for _, l := range snap.Routes.Concurrency() {
+				fn(l)
+			}
+		}
+	}
+
+	metrics.NewGaugeFunc("gateway_circuit_breaker_state",
+		"Estado del circuit breaker de cada upstream (1 en el estado actual).", []string{"upstream", "state"},
+		func(emit metrics.Emit) {
+			pools(func(p proxy.PoolStatus) {
+				for _, s := range breakerStates {
+					v := 0.0
+					if p.Breaker.State == s {
+						v = 1
+					}
+					emit(v, p.Name, s)
+				}
+			})
+		})
+	metrics.NewCounterFunc("gateway_circuit_breaker_rejected_total",
+		"Peticiones rechazadas con el circuit breaker abierto.", []string{"upstream"},
+		func(emit metrics.Emit) {
+			pools(func(p proxy.PoolStatus) { emit(float64(p.Breaker.Rejected), p.Name) })
+		})
+	metrics.NewGaugeFunc("gateway_upstream_targets_available",
+		"Instancias de cada upstream que reciben tráfico (sanas y no expulsadas).", []string{"upstream"},
+		func(emit metrics.Emit) {
+			pools(func(p proxy.PoolStatus) { emit(float64(p.Available), p.Name) })
+		})
+
+	metrics.NewGaugeFunc("gateway_concurrency_in_flight",
+		"Peticiones en curso hacia los upstreams, por límite de concurrencia (global o ruta).", []string{"limiter"},
+		func(emit metrics.Emit) {
+			limiters(func(l proxy.LimiterStatus) { emit(float64(l.InFlight), l.Name) })
+		})
+	metrics.NewGaugeFunc("gateway_concurrency_queued",
+		"Peticiones esperando lugar, por límite de concurrencia.", []string{"limiter"},
+		func(emit metrics.Emit) {
+			limiters(func(l proxy.LimiterStatus) { emit(float64(l.Queued), l.Name) })
+		})
+	metrics.NewCounterFunc("gateway_concurrency_shed_total",
+		"Peticiones descartadas por límite de concurrencia (cola llena o espera vencida).", []string{"limiter"},
+		func(emit metrics.Emit) {
+			limiters(func(l proxy.LimiterStatus) { emit(float64(l.Shed+l.Timeouts), l.Name) })
+		})
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gateway/auth"
+	"gateway/clientip"
+	"gateway/config"
+	"gateway/logging"
+	"gateway/middleware"
+	"gateway/proxy"
+	"gateway/tracing"
+)
+
+// Snapshot es una versión inmutable de la configuración activa y de todo lo
+// que se construye a partir de ella. Cada petición toma el snapshot vigente al
+// empezar y lo usa hasta terminar, aunque entretanto se aplique otro.
+type Snapshot struct {
+	Version  int64
+	Checksum string
+	LoadedAt time.Time
+	Config   *config.Config
+	Routes   *proxy.Table
+}
+
+var (
+	current atomic.Pointer[Snapshot]
+	applyMu sync.Mutex
+)
+
+// Current devuelve el snapshot activo (nil antes del primer Apply).
+func Current() *Snapshot {
+	return current.Load()
+}
+
+// Apply valida cfg, construye los componentes derivados y los publica.
+// Si algo falla, el snapshot anterior sigue activo sin cambios.
+func Apply(cfg *config.Config) (*Snapshot, error) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	prev := current.Load()
+	if prev != nil {
+		keepRestartOnly(prev.Config, cfg)
+	}
+
+	sum, err := checksum(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.Checksum == sum {
+		return prev, nil
+	}
+
+	// Primero todo lo que puede fallar...
+	if _, err := auth.CookiePolicyFromConfig(cfg.Cookies); err != nil {
+		return nil, err
+	}
+	var prevRoutes *proxy.Table
+	if prev != nil {
+		prevRoutes = prev.Routes
+	}
+	routes, err := proxy.NewTable(cfg.Upstreams, cfg.Routes, prevRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	// ...y luego se publica
+	if err := auth.Configure(cfg.Auth, cfg.Cookies); err != nil {
+		return nil, err
+	}
+	routes.Commit()
+	logging.Configure(cfg.Log)
+	tracing.Configure(cfg.Tracing)
+	clientip.Configure(cfg.ClientIP)
+	middleware.ConfigureIPFilter(cfg.IPFilter)
+	middleware.Configure(cfg.RateLimit)
+	proxy.ConfigureRetryBudget(cfg.RetryBudget)
+	proxy.ConfigureConcurrency(cfg.Concurrency)
+
+	var version int64 = 1
+	if prev != nil {
+		version = prev.Version + 1
+	}
+	snap := &Snapshot{
+		Version:  version,
+		Checksum: sum,
+		LoadedAt: time.Now(),
+		Config:   cfg,
+		Routes:   routes,
+	}
+	current.Store(snap)
+
+	// Los chequeos activos pasan a la tabla nueva; el estado de salud ya lo heredó
+	routes.StartHealthChecks()
+	if prevRoutes != nil {
+		prevRoutes.Close()
+	}
+	return snap, nil
+}
+
+// keepRestartOnly conserva los valores que solo se aplican al arrancar
+// (puerto, Firebase, auditoría, archivos) y avisa si cambiaron.
+func keepRestartOnly(prev, next *config.Config) {
+	if next.Server != prev.Server {
+		slog.Warn("config: cambios en server requieren reinicio, se ignoran")
+		next.Server = prev.Server
+	}
+	if next.Auth.ServiceAccountPath != prev.Auth.ServiceAccountPath {
+		slog.Warn("config: cambios en auth.service_account_path requieren reinicio, se ignoran")
+		next.Auth.ServiceAccountPath = prev.Auth.ServiceAccountPath
+	}
+	if next.Audit != prev.Audit {
+		slog.Warn("config: cambios en audit requieren reinicio, se ignoran")
+		next.Audit = prev.Audit
+	}
+	// De tracing solo sample_rate se aplica en caliente
+	rate := next.Tracing.SampleRate
+	next.Tracing.SampleRate = prev.Tracing.SampleRate
+	if next.Tracing != prev.Tracing {
+		slog.Warn("config: cambios en tracing (salvo sample_rate) requieren reinicio, se ignoran")
+		next.Tracing = prev.Tracing
+	}
+	next.Tracing.SampleRate = rate
+}
+
+// checksum identifica la configuración. El JSON omite los secretos (json:"-")
+// para no exponerlos, así que se suman aparte: si no, rotar solo una clave
+// daría el mismo checksum y Apply la ignoraría.
+func checksum(cfg *config.Config) (string, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(b)
+	for _, secret := range []string{cfg.Auth.FirebaseAPIKey, cfg.RateLimit.Store.Redis.Password} {
+		// Con el largo delante, ("ab", "c") y ("a", "bc") no coinciden
+		fmt.Fprintf(h, "\x00%d:%s", len(secret), secret)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
@@ -0,0 +1,111 @@
+// Package i18n tiene el catálogo de mensajes del gateway (es/en) y la
+// elección del idioma de cada petición.
+//
+// El idioma sale, en este orden, de ?lang=, de la cookie de idioma (que guarda
+// la preferencia del usuario) y de Accept-Language; por defecto es español.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Idiomas soportados
+const (
+	ES = "es"
+	EN = "en"
+
+	Default = ES
+)
+
+// Parse normaliza una etiqueta ("en-US", "ES") a un idioma soportado.
+func Parse(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := catalog[tag]; ok {
+		return tag, true
+	}
+	return "", false
+}
+
+// Negotiate elige el idioma soportado con mayor q en Accept-Language; a igual
+// q gana el que aparece primero.
+func Negotiate(header string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang, ok := Parse(fields[0])
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v, found := strings.CutPrefix(strings.TrimSpace(f), "q="); found {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// -------------------------
+// Idioma de la petición
+// -------------------------
+
+type langKey struct{}
+
+// WithLang guarda el idioma elegido en el contexto de la petición.
+func WithLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromRequest devuelve el idioma de r: el que eligió el middleware de idioma
+// o, si no pasó por él, el de Accept-Language.
+func FromRequest(r *http.Request) string {
+	if lang, ok := r.Context().Value(langKey{}).(string); ok {
+		return lang
+	}
+	return Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// -------------------------
+// Catálogo
+// -------------------------
+
+// T traduce key a lang. Sin traducción usa la española, y si tampoco existe
+// devuelve la propia key (así un texto literal pasa tal cual). Con args el
+// mensaje se formatea con fmt.Sprintf.
+func T(lang, key string, args ...interface{}) string {
+	msg, ok := catalog[lang][key]
+	if !ok {
+		if msg, ok = catalog[Default][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Messages devuelve los mensajes de lang cuya key empieza con prefix, sin el
+// prefijo (p.ej. los textos que usa el JS de una página).
+func Messages(lang, prefix string) map[string]string {
+	out := map[string]string{}
+	for _, l := range []string{Default, lang} {
+		for k, v := range catalog[l] {
+			if strings.HasPrefix(k, prefix) {
+				out[strings.TrimPrefix(k, prefix)] = v
+			}
+		}
+	}
+	return out
+}
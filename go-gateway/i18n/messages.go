@@ -0,0 +1,280 @@
+package i18n
+
+// catalog tiene los mensajes por idioma. Las keys se agrupan por prefijo:
+//   - problem.<código>: títulos de los errores (application/problem+json)
+//   - detail.*: detalles de esos errores (algunos con formato, %s)
+//   - login.*, register.*, dashboard.*: textos de los templates
+//   - js.*: textos que usa el JS del dashboard (ver Messages)
+//
+// Toda key nueva va en los dos idiomas.
+var catalog = map[string]map[string]string{
+	ES: {
+		// Errores
+		"problem.invalid_request":         "Solicitud inválida",
+		"problem.method_not_allowed":      "Método no permitido",
+		"problem.not_found":               "Recurso no encontrado",
+		"problem.unauthorized":            "Autenticación requerida",
+		"problem.invalid_token":           "Token inválido o expirado",
+		"problem.invalid_credentials":     "Credenciales incorrectas",
+		"problem.session_expired":         "La sesión expiró",
+		"problem.forbidden":               "Permisos insuficientes",
+		"problem.impersonation_forbidden": "Operación no permitida durante la suplantación",
+		"problem.csrf_invalid":            "Token CSRF inválido",
+		"problem.email_exists":            "El email ya está registrado",
+		"problem.rate_limited":            "Demasiadas peticiones, vuelve a intentarlo más tarde",
+		"problem.ip_forbidden":            "Acceso no permitido desde esta red",
+		"problem.ip_banned":               "Acceso bloqueado temporalmente por abuso",
+		"problem.internal":                "Error interno",
+		"problem.bad_gateway":             "No se pudo contactar al servicio",
+		"problem.upstream_unavailable":    "Servicio no disponible",
+		"problem.circuit_open":            "Servicio no disponible temporalmente",
+		"problem.overloaded":              "Servicio saturado, vuelve a intentarlo en unos segundos",
+		"problem.audit_unavailable":       "No se pudo registrar la acción en la auditoría; no se ejecutó",
+		"problem.upstream_timeout":        "El servicio no respondió a tiempo",
+
+		"detail.invalid_json":               "JSON inválido",
+		"detail.missing_id_token":           "falta el idToken",
+		"detail.invalid_id_token":           "idToken de Firebase inválido",
+		"detail.invalid_email":              "email inválido",
+		"detail.weak_credentials":           "revisa el email y la contraseña (mínimo 6 caracteres)",
+		"detail.invalid_lang":               "idioma no soportado: %s",
+		"detail.profile_unavailable":        "no se pudo obtener el perfil",
+		"detail.quota_unavailable":          "no se pudo consultar el consumo",
+		"detail.refresh_invalid":            "refresh token inválido",
+		"detail.refresh_expired":            "refresh token expirado",
+		"detail.requires_role":              "requiere el rol %s",
+		"detail.requires_scope":             "requiere el scope %s",
+		"detail.ban_not_found":              "la IP %s no está baneada",
+		"detail.user_not_found":             "no existe el usuario %s",
+		"detail.impersonation_uid_required": "falta el uid a suplantar",
+		"detail.impersonation_self":         "no puedes suplantarte a ti mismo",
+		"detail.audit_failed":               "no se pudo auditar la suplantación",
+		"detail.csrf_failed":                "no se pudo generar el token CSRF",
+		"detail.upstream":                   "servicio %s",
+		"detail.no_targets":                 "servicio %s sin instancias disponibles",
+		"detail.circuit_open":               "servicio %s: circuito abierto",
+		"detail.overloaded":                 "ruta %s: demasiadas peticiones en curso",
+
+		// Respuestas JSON
+		"auth.registered": "Usuario registrado",
+		"auth.lang_saved": "Idioma guardado",
+
+		// Comunes
+		"app.name":  "SISTEMA INVERNADERO",
+		"app.title": "Sistema Invernadero",
+		"lang.es":   "Español",
+		"lang.en":   "English",
+
+		// login.html
+		"login.page_title": "Login",
+		"login.subtitle":   "Acceso",
+		"login.email":      "Correo",
+		"login.password":   "Contraseña",
+		"login.submit":     "🚀 Entrar al Sistema",
+		"login.no_account": "¿No tienes una cuenta?",
+		"login.register":   "📝 Registrarse",
+		"login.hint":       "Usa tu correo y contraseña registrados en Firebase.",
+		"login.failed":     "Credenciales incorrectas.",
+		"login.error":      "Error al iniciar sesión.",
+
+		// register.html
+		"register.page_title": "Registro",
+		"register.heading":    "Crear cuenta",
+		"register.name":       "Nombre",
+		"register.submit":     "📝 Registrar Usuario",
+		"register.back":       "🔙 Volver al Login",
+		"register.failed":     "Error al registrar usuario.",
+		"register.created":    "Usuario creado correctamente. Ahora puedes iniciar sesión.",
+
+		// dashboard.html
+		"dashboard.page_title":          "Dashboard",
+		"dashboard.subtitle":            "Panel de Control",
+		"dashboard.viewing_as":          "⚠️ Estás viendo el panel como",
+		"dashboard.impersonated_by":     "(suplantado por %s). Los actuadores están en solo lectura y cada acción queda auditada.",
+		"dashboard.end_impersonation":   "Terminar suplantación",
+		"dashboard.zones":               "Zonas",
+		"dashboard.logout":              "Cerrar Sesión",
+		"dashboard.active_devices":      "Dispositivos Activos",
+		"dashboard.active_alerts":       "Alertas Activas",
+		"dashboard.avg_temperature":     "Temperatura Promedio",
+		"dashboard.avg_humidity":        "Humedad Promedio",
+		"dashboard.devices":             "Dispositivos",
+		"dashboard.new_device":          "Nuevo Dispositivo",
+		"dashboard.realtime":            "Métricas en Tiempo Real",
+		"dashboard.add_device":          "Agregar Dispositivo",
+		"dashboard.device_type":         "Tipo de Dispositivo *",
+		"dashboard.select_type":         "Selecciona un tipo",
+		"dashboard.name":                "Nombre *",
+		"dashboard.name_placeholder":    "Ej: Sensor Temp A1",
+		"dashboard.description":         "Descripción",
+		"dashboard.description_max":     "Máx. 15 caracteres",
+		"dashboard.chars_left":          "Caracteres restantes:",
+		"dashboard.location":            "Ubicación/Zona *",
+		"dashboard.select_zone":         "Selecciona una zona",
+		"dashboard.zone":                "Zona %s",
+		"dashboard.cancel":              "Cancelar",
+		"dashboard.save":                "Guardar",
+		"dashboard.confirm_delete":      "Confirmar Eliminación",
+		"dashboard.confirm_delete_text": "¿Estás seguro de que deseas eliminar este dispositivo?",
+		"dashboard.delete":              "Eliminar",
+
+		// JS del dashboard
+		"js.locale":             "es-ES",
+		"js.zone":               "Zona",
+		"js.type_temperature":   "🌡️ Sensor Temperatura",
+		"js.type_humidity":      "💧 Sensor Humedad",
+		"js.type_light":         "💡 Sensor Luz",
+		"js.type_actuator":      "⚡ Actuador",
+		"js.type_unknown":       "❓ Dispositivo",
+		"js.no_devices":         "No hay dispositivos registrados",
+		"js.connecting":         "Conectando con el servidor...",
+		"js.active":             "Activo",
+		"js.inactive":           "Inactivo",
+		"js.status_inactive":    "🔴 Inactivo",
+		"js.status_no_data":     "⚪ Sin datos",
+		"js.status_online":      "🟢 En línea",
+		"js.no_alerts":          "No hay alertas activas",
+		"js.all_ok":             "Todo funciona correctamente",
+		"js.level_critical":     "CRÍTICA",
+		"js.level_high":         "ALTA",
+		"js.level_medium":       "MEDIA",
+		"js.level_low":          "BAJA",
+		"js.temperature_series": "Temperatura (°C)",
+		"js.create_device_todo": "Funcionalidad de crear dispositivo - Conectar con API",
+	},
+
+	EN: {
+		// Errores
+		"problem.invalid_request":         "Invalid request",
+		"problem.method_not_allowed":      "Method not allowed",
+		"problem.not_found":               "Not found",
+		"problem.unauthorized":            "Authentication required",
+		"problem.invalid_token":           "Invalid or expired token",
+		"problem.invalid_credentials":     "Invalid credentials",
+		"problem.session_expired":         "Session expired",
+		"problem.forbidden":               "Insufficient permissions",
+		"problem.impersonation_forbidden": "Operation not allowed while impersonating",
+		"problem.csrf_invalid":            "Invalid CSRF token",
+		"problem.email_exists":            "Email already registered",
+		"problem.rate_limited":            "Too many requests, try again later",
+		"problem.ip_forbidden":            "Access not allowed from this network",
+		"problem.ip_banned":               "Access temporarily blocked due to abuse",
+		"problem.internal":                "Internal error",
+		"problem.bad_gateway":             "Could not reach the service",
+		"problem.upstream_unavailable":    "Service unavailable",
+		"problem.circuit_open":            "Service temporarily unavailable",
+		"problem.overloaded":              "Service overloaded, try again in a few seconds",
+		"problem.audit_unavailable":       "The action could not be recorded in the audit log; it was not executed",
+		"problem.upstream_timeout":        "The service did not respond in time",
+
+		"detail.invalid_json":               "invalid JSON",
+		"detail.missing_id_token":           "idToken is missing",
+		"detail.invalid_id_token":           "invalid Firebase idToken",
+		"detail.invalid_email":              "invalid email",
+		"detail.weak_credentials":           "check the email and password (at least 6 characters)",
+		"detail.invalid_lang":               "unsupported language: %s",
+		"detail.profile_unavailable":        "could not load the profile",
+		"detail.quota_unavailable":          "could not load the usage",
+		"detail.refresh_invalid":            "invalid refresh token",
+		"detail.refresh_expired":            "refresh token expired",
+		"detail.requires_role":              "requires the %s role",
+		"detail.requires_scope":             "requires the %s scope",
+		"detail.ban_not_found":              "IP %s is not banned",
+		"detail.user_not_found":             "user %s does not exist",
+		"detail.impersonation_uid_required": "the uid to impersonate is missing",
+		"detail.impersonation_self":         "you cannot impersonate yourself",
+		"detail.audit_failed":               "could not audit the impersonation",
+		"detail.csrf_failed":                "could not generate the CSRF token",
+		"detail.upstream":                   "service %s",
+		"detail.no_targets":                 "service %s has no available instances",
+		"detail.circuit_open":               "service %s: circuit open",
+		"detail.overloaded":                 "route %s: too many requests in flight",
+
+		// Respuestas JSON
+		"auth.registered": "User registered",
+		"auth.lang_saved": "Language saved",
+
+		// Comunes
+		"app.name":  "GREENHOUSE SYSTEM",
+		"app.title": "Greenhouse System",
+		"lang.es":   "Español",
+		"lang.en":   "English",
+
+		// login.html
+		"login.page_title": "Sign in",
+		"login.subtitle":   "Sign in",
+		"login.email":      "Email",
+		"login.password":   "Password",
+		"login.submit":     "🚀 Sign in",
+		"login.no_account": "Don't have an account?",
+		"login.register":   "📝 Sign up",
+		"login.hint":       "Use the email and password registered in Firebase.",
+		"login.failed":     "Invalid credentials.",
+		"login.error":      "Could not sign in.",
+
+		// register.html
+		"register.page_title": "Sign up",
+		"register.heading":    "Create account",
+		"register.name":       "Name",
+		"register.submit":     "📝 Create account",
+		"register.back":       "🔙 Back to sign in",
+		"register.failed":     "Could not register the user.",
+		"register.created":    "User created. You can now sign in.",
+
+		// dashboard.html
+		"dashboard.page_title":          "Dashboard",
+		"dashboard.subtitle":            "Control Panel",
+		"dashboard.viewing_as":          "⚠️ You are viewing the panel as",
+		"dashboard.impersonated_by":     "(impersonated by %s). Actuators are read-only and every action is audited.",
+		"dashboard.end_impersonation":   "End impersonation",
+		"dashboard.zones":               "Zones",
+		"dashboard.logout":              "Sign out",
+		"dashboard.active_devices":      "Active Devices",
+		"dashboard.active_alerts":       "Active Alerts",
+		"dashboard.avg_temperature":     "Average Temperature",
+		"dashboard.avg_humidity":        "Average Humidity",
+		"dashboard.devices":             "Devices",
+		"dashboard.new_device":          "New Device",
+		"dashboard.realtime":            "Real-Time Metrics",
+		"dashboard.add_device":          "Add Device",
+		"dashboard.device_type":         "Device Type *",
+		"dashboard.select_type":         "Select a type",
+		"dashboard.name":                "Name *",
+		"dashboard.name_placeholder":    "e.g. Temp Sensor A1",
+		"dashboard.description":         "Description",
+		"dashboard.description_max":     "Max. 15 characters",
+		"dashboard.chars_left":          "Characters left:",
+		"dashboard.location":            "Location/Zone *",
+		"dashboard.select_zone":         "Select a zone",
+		"dashboard.zone":                "Zone %s",
+		"dashboard.cancel":              "Cancel",
+		"dashboard.save":                "Save",
+		"dashboard.confirm_delete":      "Confirm Deletion",
+		"dashboard.confirm_delete_text": "Are you sure you want to delete this device?",
+		"dashboard.delete":              "Delete",
+
+		// JS del dashboard
+		"js.locale":             "en-US",
+		"js.zone":               "Zone",
+		"js.type_temperature":   "🌡️ Temperature Sensor",
+		"js.type_humidity":      "💧 Humidity Sensor",
+		"js.type_light":         "💡 Light Sensor",
+		"js.type_actuator":      "⚡ Actuator",
+		"js.type_unknown":       "❓ Device",
+		"js.no_devices":         "No devices registered",
+		"js.connecting":         "Connecting to the server...",
+		"js.active":             "Active",
+		"js.inactive":           "Inactive",
+		"js.status_inactive":    "🔴 Inactive",
+		"js.status_no_data":     "⚪ No data",
+		"js.status_online":      "🟢 Online",
+		"js.no_alerts":          "No active alerts",
+		"js.all_ok":             "Everything is working",
+		"js.level_critical":     "CRITICAL",
+		"js.level_high":         "HIGH",
+		"js.level_medium":       "MEDIUM",
+		"js.level_low":          "LOW",
+		"js.temperature_series": "Temperature (°C)",
+		"js.create_device_todo": "Create device - not connected to the API yet",
+	},
+}
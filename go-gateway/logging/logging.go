@@ -0,0 +1,119 @@
+// Package logging configura log/slog para todo el gateway: JSON (o texto) por
+// stdout, nivel configurable, el ID de la petición en cada registro que se
+// emite con contexto, y sin secretos (tokens, passwords, cookies).
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"gateway/config"
+	"gateway/requestid"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redacted reemplaza los valores sensibles.
+const redacted = "[REDACTED]"
+
+var level = new(slog.LevelVar)
+
+// Configure instala el logger por defecto de slog (y del paquete log). Se
+// puede volver a llamar al recargar la config.
+func Configure(cfg config.LogConfig) {
+	level.Set(parseLevel(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var h slog.Handler
+	if cfg.Format == config.LogText {
+		h = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		h = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+}
+
+// Debug indica si está activo el nivel debug.
+func Debug() bool {
+	return level.Level() <= slog.LevelDebug
+}
+
+func parseLevel(s string) slog.Level {
+	switch s {
+	case config.LogDebug:
+		return slog.LevelDebug
+	case config.LogWarn:
+		return slog.LevelWarn
+	case config.LogError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// contextHandler agrega request_id (y trace_id/span_id si la petición se está
+// trazando) a los registros emitidos con el contexto de una petición
+// (slog.InfoContext, slog.ErrorContext...).
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// -------------------------
+// Redacción
+// -------------------------
+// Por nombre de campo (password, token, cookie...) se oculta el valor entero;
+// en el resto de los textos y errores se ocultan los JWT y los "Bearer x"
+// que aparezcan (p.ej. dentro de un error de Firebase).
+
+var sensitiveKeys = []string{"password", "token", "secret", "cookie", "authorization", "api_key", "apikey"}
+
+var (
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+// scrub oculta los tokens que aparezcan en s.
+func scrub(s string) string {
+	if !strings.Contains(s, "eyJ") && !strings.Contains(strings.ToLower(s), "bearer") {
+		return s
+	}
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	return jwtPattern.ReplaceAllString(s, redacted)
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"path/filepath"
-	"runtime"
+	"os"
+	"strings"
 
+	"gateway/audit"
 	"gateway/auth"
+	"gateway/clientip"
+	"gateway/config"
+	"gateway/gateway"
+	"gateway/i18n"
+	"gateway/logging"
+	"gateway/metrics"
 	"gateway/middleware"
+	"gateway/problem"
+	"gateway/proxy"
+	"gateway/tracing"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,34 +28,89 @@ import (
 func main() {
 
 	// -------------------------
-	// 1. RUTA REAL DEL SERVICE ACCOUNT
+	// 1. CONFIGURACIÓN (archivo + entorno + flags)
 	// -------------------------
-	_, file, _, _ := runtime.Caller(0)
-	base := filepath.Dir(file)
-	saPath := filepath.Join(base, "serviceAccountKey.json")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("configuración inválida", err)
+	}
+	logging.Configure(cfg.Log)
+
+	// Trazas (OpenTelemetry); exporter y endpoint requieren reinicio
+	shutdownTracing, err := tracing.Init(cfg.Tracing)
+	if err != nil {
+		fatal("configuración inválida", err)
+	}
+
+	// Primer snapshot: auth, rate limit y upstreams
+	snap, err := gateway.Apply(cfg)
+	if err != nil {
+		fatal("configuración inválida", err)
+	}
+	slog.Info("configuración activa", "version", snap.Version, "checksum", snap.Checksum)
+
+	// Recarga en caliente: cambios del archivo o SIGHUP
+	go config.Watch(context.Background(), os.Args[1:], cfg.Source, cfg.Server.ReloadInterval, func(next *config.Config) error {
+		snap, err := gateway.Apply(next)
+		if err == nil {
+			slog.Info("configuración activa", "version", snap.Version, "checksum", snap.Checksum)
+		}
+		return err
+	})
 
 	// Inicializar Firebase + claves RSA
-	if err := auth.InitFirebase(saPath); err != nil {
-		log.Fatalf("Error inicializando Firebase: %v", err)
+	if err := auth.InitFirebase(cfg.Auth.ServiceAccountPath); err != nil {
+		fatal("error inicializando Firebase", err)
+	}
+
+	// Log de auditoría (append-only, encadenado por hash)
+	if err := audit.Init(cfg.Audit.Path); err != nil {
+		fatal("error inicializando auditoría", err)
 	}
 
 	// -------------------------
 	// 2. INIT GIN + Rate Limiter Global
 	// -------------------------
-	r := gin.Default()
+	// El modo debug de Gin solo con log debug
+	if !logging.Debug() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	// La IP del cliente la resuelve el paquete clientip (client_ip en la
+	// config); c.ClientIP() queda con la IP de la conexión
+	if err := r.SetTrustedProxies(nil); err != nil {
+		fatal("error configurando Gin", err)
+	}
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.TracingMiddleware())
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.MetricsMiddleware())
+	r.Use(middleware.LocaleMiddleware())
+	// Un panic también responde con problem+json
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		problem.Abort(c, problem.Internal, "")
+	}))
+	r.Use(middleware.ClaimsMiddleware())
+	r.Use(middleware.IPFilterMiddleware())
 	r.Use(middleware.RateLimitMiddleware())
+	r.Use(middleware.ImpersonationMiddleware())
+	r.Use(middleware.CSRFMiddleware())
 
 	// ARCHIVOS ESTÁTICOS
-	r.Static("/static", "./static")
+	r.Static("/static", cfg.Server.StaticDir)
 
-	// TEMPLATES HTML
-	r.LoadHTMLGlob("templates/*.html")
+	// TEMPLATES HTML ({{ t .Lang "key" }} traduce con el catálogo)
+	r.SetFuncMap(template.FuncMap{"t": i18n.T})
+	r.LoadHTMLGlob(cfg.Server.TemplatesGlob)
 
 	// -------------------------
 	// 3. LOGIN PAGE (HTML)
 	// -------------------------
 	r.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "login.html", nil)
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"Lang":      middleware.Lang(c),
+			"CSRFToken": c.GetString(middleware.CSRFKey),
+		})
 	})
 
 	// -------------------------
@@ -54,18 +120,31 @@ func main() {
 
 		idToken := c.PostForm("idToken")
 		if idToken == "" {
-			c.JSON(400, gin.H{"error": "faltó idToken"})
+			problem.Abort(c, problem.InvalidRequest, "detail.missing_id_token")
 			return
 		}
 
-		resp, err := auth.LoginWithIDToken(idToken)
+		resp, err := auth.LoginWithIDToken(c.Request.Context(), idToken)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			slog.WarnContext(c.Request.Context(), "login: idToken rechazado", "error", err)
+			middleware.LoginFailed(c)
+			problem.Abort(c, problem.InvalidToken, "detail.invalid_id_token")
+			return
+		}
+		if errors.Is(err, auth.ErrFirebase) {
+			slog.ErrorContext(c.Request.Context(), "login fallido", "error", err)
+			problem.Abort(c, problem.BadGateway, "detail.upstream", "firebase")
+			return
+		}
 		if err != nil {
-			c.JSON(401, gin.H{"error": err.Error()})
+			slog.ErrorContext(c.Request.Context(), "login fallido", "error", err)
+			problem.Abort(c, problem.Internal, "")
 			return
 		}
 
-		// Guarda access token en cookie
-		c.SetCookie("access_token", resp.AccessToken, 3600, "/", "", false, true)
+		// Guarda access + refresh token en cookies
+		auth.SetSessionCookies(c.Writer, resp)
+		rememberLang(c, resp.UID)
 
 		c.Redirect(http.StatusFound, "/dashboard")
 	})
@@ -74,7 +153,10 @@ func main() {
 	// 5. REGISTER PAGE (HTML)
 	// -------------------------
 	r.GET("/register", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "register.html", nil)
+		c.HTML(http.StatusOK, "register.html", gin.H{
+			"Lang":      middleware.Lang(c),
+			"CSRFToken": c.GetString(middleware.CSRFKey),
+		})
 	})
 
 	// -------------------------
@@ -88,7 +170,38 @@ func main() {
 	// 7. LOGIN BASIC REAL (JSON)
 	// -------------------------
 	r.POST("/login-basic", func(c *gin.Context) {
-		auth.LoginBasicHandler(c.Writer, c.Request)
+
+		var body struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.Abort(c, problem.InvalidRequest, "detail.invalid_json")
+			return
+		}
+
+		resp, err := auth.LoginWithPassword(c.Request.Context(), body.Email, body.Password)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			middleware.LoginFailed(c)
+			problem.Abort(c, problem.InvalidCredentials, "")
+			return
+		}
+		if errors.Is(err, auth.ErrFirebase) {
+			slog.ErrorContext(c.Request.Context(), "login-basic fallido", "error", err)
+			problem.Abort(c, problem.BadGateway, "detail.upstream", "firebase")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "login-basic fallido", "error", err)
+			problem.Abort(c, problem.Internal, "")
+			return
+		}
+
+		// La sesión del navegador vive en cookies HttpOnly
+		auth.SetSessionCookies(c.Writer, resp)
+		rememberLang(c, resp.UID)
+
+		c.JSON(200, resp)
 	})
 
 	// -------------------------
@@ -96,39 +209,166 @@ func main() {
 	// -------------------------
 	r.GET("/dashboard", func(c *gin.Context) {
 
-		token := getAccessTokenFromRequest(c)
-
-		if token == "" || !auth.ValidateAccessToken(token) {
-			c.Redirect(302, "/")
+		claims := middleware.SessionClaims(c)
+		if claims == nil {
+			// /refresh renueva la sesión con la cookie de refresh o manda al login
+			middleware.RedirectToSilentRefresh(c)
 			return
 		}
 
+		profile, err := auth.ProfileFor(c.Request.Context(), claims)
+		if err != nil {
+			// Si Firebase no responde, el panel sigue usable con el uid del token
+			slog.ErrorContext(c.Request.Context(), "perfil", "uid", claims.UID, "error", err)
+			profile = auth.Profile{UID: claims.UID, Roles: claims.Roles, Zones: []string{}}
+		}
+
+		lang := middleware.Lang(c)
+
 		c.HTML(200, "dashboard.html", gin.H{
-			"Username": "Usuario Autenticado",
+			"Lang":            lang,
+			"JS":              i18n.Messages(lang, "js."),
+			"Username":        profile.DisplayName(),
+			"Email":           profile.Email,
+			"Roles":           profile.Roles,
+			"Zones":           profile.Zones,
+			"Impersonating":   claims.Impersonated(),
+			"ImpersonatedUID": claims.UID,
+			"ActorUID":        claims.Actor,
+			"CSRFToken":       c.GetString(middleware.CSRFKey),
 		})
 	})
 
 	// -------------------------
-	// 9. LOGOUT - GET + POST
+	// 8.1 PERFIL DEL USUARIO (JSON)
 	// -------------------------
+	r.GET("/me", func(c *gin.Context) {
+
+		claims := middleware.SessionClaims(c)
+		if claims == nil {
+			problem.Abort(c, problem.InvalidToken, "")
+			return
+		}
+
+		profile, err := auth.ProfileFor(c.Request.Context(), claims)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "perfil", "uid", claims.UID, "error", err)
+			problem.Abort(c, problem.BadGateway, "detail.profile_unavailable")
+			return
+		}
 
-	// GET (para tu botón HTML)
-	r.GET("/logout", func(c *gin.Context) {
-		c.SetCookie("access_token", "", -1, "/", "", false, true)
-		c.Redirect(302, "/")
+		c.JSON(200, profile)
 	})
 
-	// POST (para llamadas AJAX si quisieras en el futuro)
-	r.POST("/logout", func(c *gin.Context) {
-		c.SetCookie("access_token", "", -1, "/", "", false, true)
-		c.Redirect(302, "/")
+	// -------------------------
+	// 8.2 IDIOMA PREFERIDO
+	// -------------------------
+	// Body: { "lang": "es" | "en" }. Queda en la cookie y en la cuenta (custom
+	// claim "lang"), así se aplica también al iniciar sesión en otro navegador.
+	r.POST("/me/lang", func(c *gin.Context) {
+
+		claims := middleware.SessionClaims(c)
+		if claims == nil {
+			problem.Abort(c, problem.InvalidToken, "")
+			return
+		}
+
+		var body struct {
+			Lang string `json:"lang"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.Abort(c, problem.InvalidRequest, "detail.invalid_json")
+			return
+		}
+		lang, ok := i18n.Parse(body.Lang)
+		if !ok {
+			problem.Abort(c, problem.InvalidRequest, "detail.invalid_lang", body.Lang)
+			return
+		}
+
+		// Suplantando solo cambia el navegador del operador, no la cuenta
+		if !claims.Impersonated() {
+			if err := auth.SetLanguage(c.Request.Context(), claims.UID, lang); err != nil {
+				slog.ErrorContext(c.Request.Context(), "idioma", "uid", claims.UID, "error", err)
+				problem.Abort(c, problem.BadGateway, "")
+				return
+			}
+		}
+		auth.SetLangCookie(c.Writer, lang)
+
+		c.JSON(200, gin.H{
+			"lang":    lang,
+			"message": i18n.T(lang, "auth.lang_saved"),
+		})
 	})
 
+	// -------------------------
+	// 8.3 CONSUMO DE RATE LIMIT
+	// -------------------------
+	// Cuánto le queda a quien consulta en cada política que le aplica (mismas
+	// claves que usa el gateway al limitar). No consume cuota.
+	r.GET("/me/quota", func(c *gin.Context) {
+
+		claims := middleware.SessionClaims(c)
+		if claims == nil {
+			problem.Abort(c, problem.InvalidToken, "")
+			return
+		}
+
+		quotas, err := middleware.Quotas(c, claims, gateway.Current().Config.Routes)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "consumo", "uid", claims.UID, "error", err)
+			problem.Abort(c, problem.BadGateway, "detail.quota_unavailable")
+			return
+		}
+
+		c.JSON(200, gin.H{"quotas": quotas})
+	})
+
+	// -------------------------
+	// 9. LOGOUT - solo POST con token CSRF
+	// -------------------------
+	// Con GET cualquier <img src="/logout"> de otro sitio cerraría la sesión
+	r.POST("/logout", middleware.RequireCSRF(), logout)
+
 	// -------------------------
 	// 10. REFRESH TOKEN
 	// -------------------------
-	r.POST("/refresh", func(c *gin.Context) {
-		auth.RefreshHandler(c.Writer, c.Request)
+	// Con ?next= es la renovación silenciosa del navegador (cookie de refresh,
+	// solo enviada a /refresh); sin él, el endpoint JSON de siempre.
+	// La silenciosa llega por un 307 que conserva el método original, así que
+	// no puede ser solo POST: se exige que venga del propio sitio (salvo la
+	// navegación GET, ver refreshOrigin).
+	r.Any("/refresh", refreshOrigin(), func(c *gin.Context) {
+
+		next := c.Query("next")
+		if next == "" {
+			if c.Request.Method != http.MethodPost {
+				problem.Abort(c, problem.MethodNotAllowed, "")
+				return
+			}
+			auth.RefreshHandler(c.Writer, c.Request)
+			return
+		}
+
+		resp, err := auth.RotateRefreshToken(c.Request.Context(), auth.RefreshTokenFromCookie(c.Request))
+		if err != nil {
+			// Un token ya rotado puede ser de una petición que perdió la
+			// carrera: la ganadora ya dejó las cookies nuevas, no se borran
+			if errors.Is(err, auth.ErrRefreshExpired) {
+				auth.ClearSessionCookies(c.Writer)
+			}
+			if gateway.IsProxiedPath(next) {
+				problem.Abort(c, problem.SessionExpired, "")
+				return
+			}
+			c.Redirect(302, "/")
+			return
+		}
+
+		auth.SetSessionCookies(c.Writer, resp)
+		// 307 conserva método y cuerpo de la petición original
+		c.Redirect(http.StatusTemporaryRedirect, safeNext(next))
 	})
 
 	// -------------------------
@@ -139,56 +379,222 @@ func main() {
 	})
 
 	// -------------------------
-	// 12. PROXY JAVA
+	// 12. ADMIN - SUPLANTACIÓN
 	// -------------------------
-	javaURL, _ := url.Parse("http://java-service:8080")
-	javaProxy := httputil.NewSingleHostReverseProxy(javaURL)
+	// Terminar queda fuera del grupo: mientras dura la suplantación la sesión
+	// es la del usuario suplantado, no la del admin
+	r.POST("/admin/impersonate/end", middleware.RequireCSRF(), endImpersonation)
+
+	admin := r.Group("/admin", middleware.RequireRole(auth.RoleAdmin))
 
-	r.Any("/api/*path", func(c *gin.Context) {
+	admin.POST("/impersonate/:uid", func(c *gin.Context) {
 
-		token := getAccessTokenFromRequest(c)
-		if token == "" || !auth.ValidateAccessToken(token) {
-			c.JSON(401, gin.H{"error": "token inválido"})
+		claims := c.MustGet(middleware.ClaimsKey).(*auth.AccessClaims)
+		target := c.Param("uid")
+
+		token, err := auth.Impersonate(c.Request.Context(), claims.UID, target)
+		switch {
+		case errors.Is(err, auth.ErrUserNotFound):
+			problem.Abort(c, problem.NotFound, "detail.user_not_found", target)
+			return
+		case errors.Is(err, auth.ErrSelfImpersonation):
+			problem.Abort(c, problem.InvalidRequest, "detail.impersonation_self")
+			return
+		case errors.Is(err, auth.ErrImpersonationNoUID):
+			problem.Abort(c, problem.InvalidRequest, "detail.impersonation_uid_required")
+			return
+		case err != nil:
+			slog.ErrorContext(c.Request.Context(), "suplantación", "uid", claims.UID, "target", target, "error", err)
+			problem.Abort(c, problem.Internal, "")
 			return
 		}
 
-		javaProxy.ServeHTTP(c.Writer, c.Request)
+		if err := audit.Log(audit.Record{
+			Event:     "impersonation_started",
+			Actor:     claims.UID,
+			Subject:   target,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			IP:        clientip.FromRequest(c.Request),
+			Status:    http.StatusOK,
+			RequestID: c.GetString(middleware.RequestIDKey),
+		}); err != nil {
+			problem.Abort(c, problem.Internal, "detail.audit_failed")
+			return
+		}
+
+		// La cookie permite abrir /dashboard tal como lo ve el operador. Va
+		// aparte de la sesión del admin, que queda intacta para cuando termine
+		ttl := auth.Current().ImpersonationTTL
+		maxAge := int(ttl.Seconds())
+		auth.SetImpersonationCookie(c.Writer, token, ttl)
+
+		c.JSON(200, gin.H{
+			"access_token": token,
+			"uid":          target,
+			"act":          claims.UID,
+			"expires_in":   maxAge,
+		})
 	})
 
-	// -------------------------
-	// 13. PROXY PYTHON
-	// -------------------------
-	pythonURL, _ := url.Parse("http://python-service:8000")
-	pythonProxy := httputil.NewSingleHostReverseProxy(pythonURL)
+	// Configuración activa (versión, checksum y valores; sin secretos)
+	admin.GET("/config", func(c *gin.Context) {
+
+		snap := gateway.Current()
+
+		c.JSON(200, gin.H{
+			"version":   snap.Version,
+			"checksum":  snap.Checksum,
+			"loaded_at": snap.LoadedAt,
+			"source":    snap.Config.Source,
+			"config":    snap.Config,
+		})
+	})
+
+	// Salud de los upstreams (chequeos activos y pasivos)
+	admin.GET("/upstreams", func(c *gin.Context) {
+		c.JSON(200, gateway.Current().Routes.Status())
+	})
+
+	// Límites de concurrencia: global y por ruta (en curso, en cola, descartadas)
+	admin.GET("/concurrency", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"global": proxy.GlobalConcurrency(),
+			"routes": gateway.Current().Routes.Concurrency(),
+		})
+	})
+
+	// IPs baneadas automáticamente en esta réplica (rate limit, logins fallidos)
+	admin.GET("/bans", func(c *gin.Context) {
+		c.JSON(200, middleware.Bans())
+	})
 
-	r.Any("/python-api/*path", func(c *gin.Context) {
+	admin.DELETE("/bans/:ip", func(c *gin.Context) {
 
-		token := getAccessTokenFromRequest(c)
-		if token == "" || !auth.ValidateAccessToken(token) {
-			c.JSON(401, gin.H{"error": "token inválido"})
+		ip := c.Param("ip")
+		if !middleware.Unban(ip) {
+			problem.Abort(c, problem.NotFound, "detail.ban_not_found", ip)
 			return
 		}
+		c.Status(http.StatusNoContent)
+	})
+
+	admin.GET("/status", func(c *gin.Context) {
+
+		snap := gateway.Current()
 
-		pythonProxy.ServeHTTP(c.Writer, c.Request)
+		c.HTML(200, "status.html", gin.H{
+			"Version":   snap.Version,
+			"Upstreams": snap.Routes.Status(),
+		})
 	})
 
+	// -------------------------
+	// 13. MÉTRICAS (Prometheus)
+	// -------------------------
+	// Sin token: el scraper no tiene sesión. Se restringe por IP con un
+	// grupo de ip_filter (ver config.example.yaml).
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// -------------------------
+	// 14. PROXIES (tabla de rutas declarativa)
+	// -------------------------
+	// Todo lo que no es ruta propia del gateway se busca en la tabla del
+	// snapshot vigente (config `routes`), así que agregar un microservicio
+	// es solo cambiar la configuración.
+	r.NoRoute(gateway.ProxyHandler)
+
 	// -------------------------
 	// INICIAR SERVIDOR
 	// -------------------------
-	log.Println("🔥 Go Gateway corriendo en http://localhost:8081")
-	r.Run(":8081")
+	slog.Info("🔥 Go Gateway corriendo", "addr", cfg.Server.Addr)
+	err = r.Run(cfg.Server.Addr)
+	// Lo que quedó en el batch de trazas se envía antes de salir
+	shutdownTracing(context.Background())
+	fatal("servidor", err)
+}
+
+// fatal registra err y termina el proceso.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// ----------------------------------------
+// Logout: revoca el refresh y borra cookies
+// ----------------------------------------
+func logout(c *gin.Context) {
+	if rt := auth.RefreshTokenFromCookie(c.Request); rt != "" {
+		auth.RevokeRefreshToken(rt)
+	}
+	auth.ClearSessionCookies(c.Writer)
+	c.Redirect(302, "/")
 }
 
 // ----------------------------------------
-// Helper para obtener access_token
+// endImpersonation borra la cookie de suplantación y vuelve al panel con la
+// sesión propia del admin, que no se tocó (ni su refresh token)
 // ----------------------------------------
-func getAccessTokenFromRequest(c *gin.Context) string {
+func endImpersonation(c *gin.Context) {
+	if claims := middleware.SessionClaims(c); claims != nil && claims.Impersonated() {
+		if err := audit.Log(audit.Record{
+			Event:     "impersonation_ended",
+			Actor:     claims.Actor,
+			Subject:   claims.UID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			IP:        clientip.FromRequest(c.Request),
+			Status:    http.StatusFound,
+			RequestID: c.GetString(middleware.RequestIDKey),
+		}); err != nil {
+			slog.ErrorContext(c.Request.Context(), "audit: no se pudo registrar", "error", err)
+		}
+	}
+	auth.ClearImpersonationCookie(c.Writer)
+	c.Redirect(http.StatusFound, "/dashboard")
+}
 
-	authHeader := c.GetHeader("Authorization")
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		return authHeader[7:]
+// ----------------------------------------
+// rememberLang pasa el idioma preferido de la cuenta a la cookie
+// ----------------------------------------
+func rememberLang(c *gin.Context, uid string) {
+	profile, err := auth.LookupProfile(c.Request.Context(), uid)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "perfil", "uid", uid, "error", err)
+		return
 	}
+	if profile.Lang != "" {
+		auth.SetLangCookie(c.Writer, profile.Lang)
+	}
+}
 
-	cookie, _ := c.Cookie("access_token")
-	return cookie
+// ----------------------------------------
+// safeNext evita redirecciones abiertas: solo rutas locales
+// ----------------------------------------
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/dashboard"
+	}
+	return next
+}
+
+// ----------------------------------------
+// refreshOrigin: /refresh solo desde el propio sitio
+// ----------------------------------------
+// Salvo la navegación GET hacia una URL local: un link desde otro sitio a
+// /dashboard con la sesión vencida llega a /refresh por un 307 y el navegador
+// marca la cadena entera como cross-site. Esa navegación solo renueva las
+// cookies y vuelve a la misma página; fetch y formularios POST siguen
+// necesitando el mismo origen.
+func refreshOrigin() gin.HandlerFunc {
+	sameOrigin := middleware.RequireSameOrigin()
+	return func(c *gin.Context) {
+		next := c.Query("next")
+		if c.Request.Method == http.MethodGet && c.GetHeader("Sec-Fetch-Mode") == "navigate" &&
+			next != "" && safeNext(next) == next {
+			c.Next()
+			return
+		}
+		sameOrigin(c)
+	}
 }
@@ -0,0 +1,285 @@
+// Package metrics expone métricas en el formato de texto de Prometheus
+// (GET /metrics). Cada paquete declara las suyas: contadores e histogramas que
+// se actualizan al pasar las peticiones, y funciones que se evalúan en cada
+// scrape para lo que ya se lleva en otro lado (estado de los breakers,
+// refresh tokens vigentes, runtime de Go).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets son los límites (en segundos) de los histogramas de latencia.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// family es una métrica con sus series, tal como se escribe en el scrape.
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]family{}
+)
+
+func register(f family) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[f.name()]; ok {
+		panic("metrics: métrica duplicada " + f.name())
+	}
+	registry[f.name()] = f
+}
+
+// desc es lo común a todas las métricas.
+type desc struct {
+	fqName string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) name() string { return d.fqName }
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fqName, escapeHelp(d.help), d.fqName, d.typ)
+}
+
+// key identifica una serie por los valores de sus labels.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s espera %d labels, recibió %d", d.fqName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// -------------------------
+// Contadores
+// -------------------------
+
+// CounterVec es un contador por combinación de labels.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registra un contador; los valores de labels se pasan en el
+// mismo orden al incrementarlo.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter", labels}, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc suma 1 a la serie de esos labels.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add suma v (no negativo) a la serie de esos labels.
+func (c *CounterVec) Add(v float64, values ...string) {
+	k := c.key(values)
+	c.mu.Lock()
+	c.values[k] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range sortedKeys(c.values) {
+		writeSample(w, c.fqName, c.labels, split(k, len(c.labels)), "", "", c.values[k])
+	}
+}
+
+// -------------------------
+// Histogramas
+// -------------------------
+
+type histogram struct {
+	counts []uint64 // por bucket, sin acumular
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec es un histograma por combinación de labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+// NewHistogramVec registra un histograma con los buckets indicados
+// (DefaultBuckets si es nil).
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels}, buckets: buckets, values: map[string]*histogram{}}
+	register(h)
+	return h
+}
+
+// Observe registra v en la serie de esos labels.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.values[k]
+	if s == nil {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, k := range sortedKeys(h.values) {
+		s, values := h.values[k], split(k, len(h.labels))
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			writeSample(w, h.fqName+"_bucket", h.labels, values, "le", formatFloat(le), float64(cum))
+		}
+		writeSample(w, h.fqName+"_bucket", h.labels, values, "le", "+Inf", float64(s.count))
+		writeSample(w, h.fqName+"_sum", h.labels, values, "", "", s.sum)
+		writeSample(w, h.fqName+"_count", h.labels, values, "", "", float64(s.count))
+	}
+}
+
+// -------------------------
+// Métricas calculadas en el scrape
+// -------------------------
+
+// Emit agrega una serie con el valor v y esos valores de labels.
+type Emit func(v float64, values ...string)
+
+type funcFamily struct {
+	desc
+	collect func(emit Emit)
+}
+
+// NewGaugeFunc registra un gauge cuyas series calcula collect en cada scrape.
+func NewGaugeFunc(name, help string, labels []string, collect func(emit Emit)) {
+	register(&funcFamily{desc{name, help, "gauge", labels}, collect})
+}
+
+// NewCounterFunc es como NewGaugeFunc para un contador que ya se lleva en
+// otro lado (tiene que ser monótono).
+func NewCounterFunc(name, help string, labels []string, collect func(emit Emit)) {
+	register(&funcFamily{desc{name, help, "counter", labels}, collect})
+}
+
+func (f *funcFamily) write(w *bufio.Writer) {
+	f.header(w)
+	f.collect(func(v float64, values ...string) {
+		f.key(values)
+		writeSample(w, f.fqName, f.labels, values, "", "", v)
+	})
+}
+
+// -------------------------
+// Exposición
+// -------------------------
+
+// Handler responde con todas las métricas registradas, ordenadas por nombre.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// WriteTo escribe todas las métricas en el formato de texto de Prometheus.
+func WriteTo(out io.Writer) error {
+	registryMu.Lock()
+	families := make([]family, 0, len(registry))
+	for _, f := range registry {
+		families = append(families, f)
+	}
+	registryMu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		f.write(w)
+	}
+	return w.Flush()
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeValue(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
+
+func split(key string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// -------------------------
+// Runtime de Go y proceso
+// -------------------------
+// Con los nombres de client_golang, así sirven los dashboards de siempre.
+
+var startTime = time.Now()
+
+var (
+	memMu   sync.Mutex
+	mem     runtime.MemStats
+	memRead time.Time
+)
+
+// memStats lee runtime.MemStats a lo sumo una vez por segundo: cada lectura
+// detiene el mundo un instante y en un scrape se usa varias veces.
+func memStats() runtime.MemStats {
+	memMu.Lock()
+	defer memMu.Unlock()
+	if time.Since(memRead) > time.Second {
+		runtime.ReadMemStats(&mem)
+		memRead = time.Now()
+	}
+	return mem
+}
+
+func init() {
+	NewGaugeFunc("go_goroutines", "Goroutines en ejecución.", nil, func(emit Emit) {
+		emit(float64(runtime.NumGoroutine()))
+	})
+	NewGaugeFunc("go_info", "Versión de Go con la que se compiló el gateway.", []string{"version"}, func(emit Emit) {
+		emit(1, runtime.Version())
+	})
+	NewGaugeFunc("process_start_time_seconds", "Inicio del proceso (Unix, segundos).", nil, func(emit Emit) {
+		emit(float64(startTime.UnixNano()) / 1e9)
+	})
+
+	NewGaugeFunc("go_memstats_alloc_bytes", "Bytes del heap asignados y en uso.", nil, func(emit Emit) {
+		emit(float64(memStats().Alloc))
+	})
+	NewGaugeFunc("go_memstats_heap_inuse_bytes", "Bytes en spans del heap en uso.", nil, func(emit Emit) {
+		emit(float64(memStats().HeapInuse))
+	})
+	NewGaugeFunc("go_memstats_heap_objects", "Objetos asignados en el heap.", nil, func(emit Emit) {
+		emit(float64(memStats().HeapObjects))
+	})
+	NewGaugeFunc("go_memstats_sys_bytes", "Bytes obtenidos del sistema operativo.", nil, func(emit Emit) {
+		emit(float64(memStats().Sys))
+	})
+	NewCounterFunc("go_memstats_gc_completed_total", "Ciclos de GC completados.", nil, func(emit Emit) {
+		emit(float64(memStats().NumGC))
+	})
+	NewCounterFunc("go_memstats_gc_pause_seconds_total", "Tiempo total de pausas del GC.", nil, func(emit Emit) {
+		emit(float64(memStats().PauseTotalNs) / 1e9)
+	})
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"gateway/clientip"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Claves del contexto Gin que completan el log de accesos de las peticiones
+// reenviadas (las pone el handler del proxy).
+const (
+	RouteKey    = "route"
+	UpstreamKey = "upstream"
+)
+
+// -------------------------
+// Log de accesos (slog)
+// -------------------------
+// Un registro por petición: método, path (sin query, que puede llevar
+// tokens), status, latencia, bytes, IP, usuario y, si se reenvió, ruta y
+// upstream. 5xx sale como error y 4xx como warn.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes_in", max(c.Request.ContentLength, 0)),
+			slog.Int("bytes_out", max(c.Writer.Size(), 0)),
+			slog.String("ip", clientip.FromRequest(c.Request)),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if claims := SessionClaims(c); claims != nil {
+			attrs = append(attrs, slog.String("uid", claims.UID))
+			if claims.Impersonated() {
+				attrs = append(attrs, slog.String("actor", claims.Actor))
+			}
+		}
+		if route := c.GetString(RouteKey); route != "" {
+			attrs = append(attrs, slog.String("route", route), slog.String("upstream", c.GetString(UpstreamKey)))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
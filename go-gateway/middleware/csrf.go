@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"gateway/auth"
+	"gateway/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CSRFKey es la clave del contexto Gin con el token CSRF vigente (para templates).
+	CSRFKey = "csrf_token"
+	// CSRFHeader es el header donde el JS debe reenviar el token.
+	CSRFHeader = "X-CSRF-Token"
+
+	csrfFormField = "csrf_token"
+)
+
+// -------------------------
+// CSRF (double-submit cookie)
+// -------------------------
+// Las peticiones autenticadas por cookie que no son GET/HEAD/OPTIONS deben
+// reenviar el valor de la cookie csrf_token en el header X-CSRF-Token o en el
+// campo de formulario csrf_token. Otro sitio no puede leer la cookie, así que
+// no puede falsificar la petición. Las llamadas con Bearer no llevan cookies
+// automáticas y quedan exentas.
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		token := auth.CSRFTokenFromCookie(c.Request)
+		if token == "" {
+			var err error
+			token, err = newCSRFToken()
+			if err != nil {
+				problem.Abort(c, problem.Internal, "detail.csrf_failed")
+				return
+			}
+			// Legible desde JS (no HttpOnly) para el double-submit
+			auth.SetCSRFCookie(c.Writer, token)
+		}
+		c.Set(CSRFKey, token)
+
+		if isSafeMethod(c.Request.Method) || !cookieAuthenticated(c) {
+			c.Next()
+			return
+		}
+
+		if !csrfMatches(c, token) {
+			problem.Abort(c, problem.CSRFInvalid, "")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireCSRF exige el token aunque la petición no traiga la cookie de acceso
+// (p.ej. /logout con la sesión ya vencida). Va detrás de CSRFMiddleware.
+func RequireCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !csrfMatches(c, c.GetString(CSRFKey)) {
+			problem.Abort(c, problem.CSRFInvalid, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// csrfMatches compara el token reenviado (header o formulario) con el de la cookie.
+func csrfMatches(c *gin.Context, token string) bool {
+	sent := c.GetHeader(CSRFHeader)
+	if sent == "" {
+		sent = c.PostForm(csrfFormField)
+	}
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// cookieAuthenticated indica si la petición depende de la cookie de sesión.
+func cookieAuthenticated(c *gin.Context) bool {
+	if UsesBearer(c) {
+		return false
+	}
+	return auth.AccessTokenFromCookie(c.Request) != ""
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
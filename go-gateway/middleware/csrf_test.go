@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gateway/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func csrfRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CSRFMiddleware())
+	r.POST("/logout", RequireCSRF(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	const token = "tok"
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		session bool   // cookie de acceso
+		bearer  bool   // Authorization: Bearer
+		cookie  string // cookie csrf_token
+		header  string // X-CSRF-Token
+		form    string // campo csrf_token
+		want    int
+	}{
+		{"GET no lo exige", http.MethodGet, "/api/x", true, false, "", "", "", http.StatusOK},
+		{"sin sesión no lo exige", http.MethodPost, "/api/x", false, false, "", "", "", http.StatusOK},
+		{"Bearer no lo exige", http.MethodPost, "/api/x", true, true, "", "", "", http.StatusOK},
+		{"sin token", http.MethodPost, "/api/x", true, false, token, "", "", http.StatusForbidden},
+		{"token en el header", http.MethodPost, "/api/x", true, false, token, token, "", http.StatusOK},
+		{"token en el formulario", http.MethodPost, "/api/x", true, false, token, "", token, http.StatusOK},
+		{"token distinto", http.MethodPost, "/api/x", true, false, token, "otro", "", http.StatusForbidden},
+		{"sin cookie no hay con qué comparar", http.MethodPost, "/api/x", true, false, "", token, "", http.StatusForbidden},
+		{"DELETE también", http.MethodDelete, "/api/x", true, false, token, "", "", http.StatusForbidden},
+		// /logout lo exige aunque la sesión ya no esté
+		{"RequireCSRF sin sesión", http.MethodPost, "/logout", false, false, token, "", "", http.StatusForbidden},
+		{"RequireCSRF con token", http.MethodPost, "/logout", false, false, token, token, "", http.StatusOK},
+	}
+	r := csrfRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.form != "" {
+				body = url.Values{"csrf_token": {tt.form}}.Encode()
+			}
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(body))
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.session {
+				req.AddCookie(&http.Cookie{Name: auth.AccessCookieName(), Value: "access"})
+			}
+			if tt.bearer {
+				req.Header.Set("Authorization", "Bearer access")
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName(), Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, se esperaba %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFCookieIssuedOnce(t *testing.T) {
+	r := csrfRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var issued *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.CSRFCookieName() {
+			issued = c
+		}
+	}
+	// El JS la lee para reenviarla: no puede ser HttpOnly
+	if issued == nil || len(issued.Value) < 32 || issued.HttpOnly {
+		t.Fatalf("cookie CSRF = %+v", issued)
+	}
+
+	// Con la cookie ya puesta no se reemplaza
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(issued)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("se volvió a emitir la cookie: %v", w.Result().Cookies())
+	}
+}
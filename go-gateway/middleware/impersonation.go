@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"gateway/audit"
+	"gateway/clientip"
+	"gateway/config"
+	"gateway/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey es la clave del contexto Gin donde se guardan los *auth.AccessClaims
+// del token de la petición (ver ClaimsMiddleware).
+const ClaimsKey = "claims"
+
+// -------------------------
+// Solo usuarios con el rol indicado
+// -------------------------
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := SessionClaims(c)
+		if claims == nil {
+			problem.Abort(c, problem.InvalidToken, "")
+			return
+		}
+		// Una sesión suplantada nunca actúa como admin, aunque el usuario lo sea
+		if claims.Impersonated() || !claims.HasRole(role) {
+			problem.Abort(c, problem.Forbidden, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// -------------------------
+// Suplantación: auditoría + solo lectura sobre actuadores
+// -------------------------
+func ImpersonationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := SessionClaims(c)
+		if claims == nil || !claims.Impersonated() {
+			c.Next()
+			return
+		}
+
+		rec := audit.Record{
+			Event:     "impersonated_request",
+			Actor:     claims.Actor,
+			Subject:   claims.UID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			IP:        clientip.FromRequest(c.Request),
+			RequestID: c.GetString(RequestIDKey),
+		}
+
+		if isActuatorWrite(c.Request) {
+			rec.Event = "impersonated_write_blocked"
+			rec.Status = http.StatusForbidden
+			logAudit(rec)
+			problem.Abort(c, problem.ImpersonationForbidden, "")
+			return
+		}
+
+		// Sin registro no se atiende: se audita antes de ejecutar la petición
+		// y, al terminar, con el status que se respondió
+		if !logAudit(rec) {
+			problem.Abort(c, problem.AuditUnavailable, "")
+			return
+		}
+
+		c.Next()
+
+		rec.Event = "impersonated_response"
+		rec.Status = c.Writer.Status()
+		logAudit(rec)
+	}
+}
+
+// isActuatorWrite compara el path normalizado (ver config.MatchPath): el
+// backend ignora "//", "/./" y los parámetros ";x" al rutear, así que
+// "/api//actuadores" o "/api/actuadores;x" también llegan a los actuadores.
+func isActuatorWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return config.MatchPath("/api/actuadores/*", r.URL.Path)
+}
+
+func logAudit(rec audit.Record) bool {
+	if err := audit.Log(rec); err != nil {
+		slog.Error("audit: no se pudo registrar", "request_id", rec.RequestID, "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gateway/audit"
+	"gateway/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonatedRouter atiende cualquier path con 200 como una sesión de admin
+// suplantando a "u1", y devuelve el archivo de auditoría donde queda registrada.
+func impersonatedRouter(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	if err := audit.Init(auditPath); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(ClaimsKey, &auth.AccessClaims{UID: "u1", Actor: "admin1"})
+	})
+	r.Use(ImpersonationMiddleware())
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r, auditPath
+}
+
+func auditEvents(t *testing.T, auditPath string) []audit.Record {
+	t.Helper()
+	f, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []audit.Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec audit.Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestImpersonationBlocksActuatorWrites(t *testing.T) {
+	for _, target := range []string{
+		"/api/actuadores/5/activar",
+		"/api//actuadores/5/activar",
+		"/api/./actuadores/5/activar",
+		"/api/x/../actuadores/5/activar",
+		"/api/actuadores;x/5/activar",
+		"/api/actuadores%3Bx/5/activar",
+		"/api/x/..;y/actuadores/5/activar",
+	} {
+		t.Run(target, func(t *testing.T) {
+			r, auditPath := impersonatedRouter(t)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, se esperaba 403", w.Code)
+			}
+			recs := auditEvents(t, auditPath)
+			if len(recs) != 1 {
+				t.Fatalf("%d registros de auditoría, se esperaba 1: %+v", len(recs), recs)
+			}
+			rec := recs[0]
+			if rec.Event != "impersonated_write_blocked" || rec.Actor != "admin1" || rec.Subject != "u1" ||
+				rec.Method != http.MethodPost || rec.Status != http.StatusForbidden {
+				t.Errorf("registro = %+v", rec)
+			}
+		})
+	}
+}
+
+func TestImpersonationAuditsAllowedRequests(t *testing.T) {
+	tests := []struct {
+		method, target string
+	}{
+		{http.MethodGet, "/api/actuadores/5"},
+		{http.MethodPost, "/api/sensores/5"},
+		{http.MethodPost, "/api/actuadoresx/5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			r, auditPath := impersonatedRouter(t)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, se esperaba 200", w.Code)
+			}
+			// Un registro antes de atender y otro con la respuesta
+			recs := auditEvents(t, auditPath)
+			if len(recs) != 2 || recs[0].Event != "impersonated_request" || recs[1].Event != "impersonated_response" {
+				t.Fatalf("registros = %+v", recs)
+			}
+			if recs[1].Status != http.StatusOK {
+				t.Errorf("status auditado = %d", recs[1].Status)
+			}
+		})
+	}
+}
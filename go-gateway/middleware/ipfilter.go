@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"gateway/clientip"
+	"gateway/config"
+	"gateway/problem"
+	"gateway/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Motivos de baneo (Ban.Reason).
+const (
+	BanRateLimited   = "rate_limited"
+	BanLoginFailures = "login_failures"
+)
+
+// Ban es una IP bloqueada temporalmente.
+type Ban struct {
+	IP     string    `json:"ip"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+type ipGroup struct {
+	name    string
+	paths   []string
+	methods []string
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+}
+
+var (
+	ipfMu     sync.RWMutex
+	ipfDeny   []netip.Prefix
+	ipfGroups []ipGroup
+	banFor    time.Duration
+	banExempt []netip.Prefix
+	// strikes cuenta, por motivo, los avisos de cada IP dentro de la ventana
+	strikes = map[string]ratelimit.Limiter{}
+	// strikeStore sobrevive a los reloads, así no se pierden las cuentas
+	strikeStore = ratelimit.NewMemory(100000)
+
+	// Los baneos son de esta réplica y sobreviven a los reloads
+	bansMu    sync.Mutex
+	bans      = map[string]Ban{}
+	lastSweep time.Time
+)
+
+// banSweepEvery es cada cuánto, como mucho, se recorren los baneos al agregar
+// uno para descartar los vencidos (los de IPs que no volvieron).
+const banSweepEvery = time.Minute
+
+// ConfigureIPFilter aplica las listas y el auto-baneo (se llama en cada reload).
+// Los CIDRs ya vienen validados.
+func ConfigureIPFilter(cfg config.IPFilterConfig) {
+	groups := make([]ipGroup, 0, len(cfg.Groups))
+	for name, g := range cfg.Groups {
+		groups = append(groups, ipGroup{
+			name:    name,
+			paths:   g.Paths,
+			methods: g.Methods,
+			allow:   prefixes(g.Allow),
+			deny:    prefixes(g.Deny),
+		})
+	}
+	// Orden estable para que el grupo que rechaza sea siempre el mismo
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+
+	counters := map[string]ratelimit.Limiter{}
+	for reason, n := range map[string]int{BanRateLimited: cfg.Ban.RateLimited, BanLoginFailures: cfg.Ban.LoginFailures} {
+		if n > 0 {
+			counters[reason] = strikeCounter(ratelimit.Limit{Requests: n, Period: cfg.Ban.Window})
+		}
+	}
+
+	ipfMu.Lock()
+	defer ipfMu.Unlock()
+	ipfDeny = prefixes(cfg.Deny)
+	ipfGroups = groups
+	banFor = cfg.Ban.Duration
+	banExempt = prefixes(cfg.Ban.Exempt)
+	strikes = counters
+
+	bansMu.Lock()
+	sweepBans(time.Now())
+	bansMu.Unlock()
+}
+
+// -------------------------
+// Filtro por IP
+// -------------------------
+// Rechaza IPs baneadas, la lista deny general y lo que no cumple el
+// allow/deny de los grupos que coinciden con la petición. Va antes del rate
+// limit para que lo rechazado no consuma cuota.
+func IPFilterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ip := clientip.FromRequest(c.Request)
+		if b, ok := banned(ip); ok {
+			c.Header("Retry-After", ceilSeconds(time.Until(b.Until)))
+			problem.Abort(c, problem.IPBanned, "")
+			return
+		}
+
+		// Una IP que no se puede leer no está en ningún allow
+		addr, _ := netip.ParseAddr(ip)
+
+		ipfMu.RLock()
+		deny, groups := ipfDeny, ipfGroups
+		ipfMu.RUnlock()
+
+		if inPrefixes(deny, addr) {
+			problem.Abort(c, problem.IPForbidden, "")
+			return
+		}
+		for _, g := range groups {
+			if !g.matches(c.Request.Method, c.Request.URL.Path) {
+				continue
+			}
+			if inPrefixes(g.deny, addr) || (len(g.allow) > 0 && !inPrefixes(g.allow, addr)) {
+				problem.Abort(c, problem.IPForbidden, "")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func (g *ipGroup) matches(method, urlPath string) bool {
+	if !config.MatchMethod(g.methods, method) {
+		return false
+	}
+	for _, p := range g.paths {
+		if config.MatchPath(p, urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func prefixes(list []string) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if p, err := config.ParsePrefix(s); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func inPrefixes(list []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range list {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// -------------------------
+// Auto-baneo
+// -------------------------
+
+// LoginFailed cuenta un login fallido de la IP de la petición.
+func LoginFailed(c *gin.Context) {
+	strike(c, BanLoginFailures)
+}
+
+// strike suma un aviso por reason a la IP de la petición y la banea al
+// llegar al máximo de la ventana.
+func strike(c *gin.Context, reason string) {
+	ipfMu.RLock()
+	l, exempt, dur := strikes[reason], banExempt, banFor
+	ipfMu.RUnlock()
+	if l == nil {
+		return
+	}
+
+	ip := clientip.FromRequest(c.Request)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || inPrefixes(exempt, addr) {
+		return
+	}
+	// El aviso que agota la ventana (Remaining 0) ya es el n-ésimo
+	res, err := l.Allow(c.Request.Context(), reason+"|"+ip)
+	if err != nil || (res.Allowed && res.Remaining > 0) {
+		return
+	}
+
+	now := time.Now()
+	bansMu.Lock()
+	if now.Sub(lastSweep) >= banSweepEvery {
+		sweepBans(now)
+	}
+	bans[ip] = Ban{IP: ip, Reason: reason, Until: now.Add(dur)}
+	bansMu.Unlock()
+	slog.WarnContext(c.Request.Context(), "ip baneada", "ip", ip, "duration", dur.String(), "reason", reason)
+}
+
+// strikeCounter cuenta avisos sobre strikeStore.
+func strikeCounter(limit ratelimit.Limit) ratelimit.Limiter {
+	return ratelimit.New(config.AlgorithmSlidingLog, strikeStore, limit)
+}
+
+// sweepBans descarta los baneos vencidos. Se llama con bansMu tomado.
+func sweepBans(now time.Time) {
+	for ip, b := range bans {
+		if now.After(b.Until) {
+			delete(bans, ip)
+		}
+	}
+	lastSweep = now
+}
+
+func banned(ip string) (Ban, bool) {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	b, ok := bans[ip]
+	if ok && time.Now().After(b.Until) {
+		delete(bans, ip)
+		return Ban{}, false
+	}
+	return b, ok
+}
+
+// Bans devuelve los baneos vigentes, los más próximos a vencer primero.
+func Bans() []Ban {
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	now := time.Now()
+	out := []Ban{}
+	for ip, b := range bans {
+		if now.After(b.Until) {
+			delete(bans, ip)
+			continue
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out
+}
+
+// Unban levanta el baneo de ip (y olvida sus avisos); false si no estaba baneada.
+func Unban(ip string) bool {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		ip = addr.Unmap().String()
+	}
+	// Aunque el motivo ya no banee, los avisos que quedaron se olvidan igual
+	for _, reason := range []string{BanRateLimited, BanLoginFailures} {
+		strikeCounter(ratelimit.Limit{}).Reset(context.Background(), reason+"|"+ip)
+	}
+
+	_, ok := banned(ip)
+	bansMu.Lock()
+	delete(bans, ip)
+	bansMu.Unlock()
+	return ok
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gateway/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configureIPFilter aplica cfg y, al terminar el test, deja el filtro vacío y
+// sin baneos ni avisos.
+func configureIPFilter(t *testing.T, cfg config.IPFilterConfig) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ConfigureIPFilter(cfg)
+	t.Cleanup(func() {
+		ConfigureIPFilter(config.IPFilterConfig{})
+		for _, b := range Bans() {
+			Unban(b.IP)
+		}
+	})
+}
+
+func ipFilteredRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(IPFilterMiddleware())
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestIPFilterGroups(t *testing.T) {
+	configureIPFilter(t, config.IPFilterConfig{
+		Groups: map[string]config.IPFilterGroup{
+			"debug":    {Paths: []string{"/api/debug/*"}, Allow: []string{"10.0.0.0/8"}},
+			"admin":    {Paths: []string{"/admin/*"}, Allow: []string{"10.0.0.0/8"}},
+			"comandos": {Paths: []string{"/api/actuadores/*"}, Methods: []string{http.MethodPost}, Allow: []string{"10.0.0.0/8"}},
+		},
+	})
+	r := ipFilteredRouter()
+
+	const planta, afuera = "10.1.2.3", "203.0.113.7"
+	tests := []struct {
+		method, target, ip string
+		want               int
+	}{
+		{http.MethodGet, "/api/debug/vars", planta, http.StatusOK},
+		{http.MethodGet, "/api/debug/vars", afuera, http.StatusForbidden},
+		{http.MethodGet, "/admin", afuera, http.StatusForbidden},
+		{http.MethodGet, "/admin/usuarios", afuera, http.StatusForbidden},
+		{http.MethodGet, "/api/sensores", afuera, http.StatusOK},
+
+		// Variantes del path que el backend rutea al mismo lugar
+		{http.MethodGet, "/api/debug;x/vars", afuera, http.StatusForbidden},
+		{http.MethodGet, "/api/debug%3Bx/vars", afuera, http.StatusForbidden},
+		{http.MethodGet, "/admin;x/usuarios", afuera, http.StatusForbidden},
+		{http.MethodGet, "/admin;x", afuera, http.StatusForbidden},
+		{http.MethodGet, "//admin/./usuarios", afuera, http.StatusForbidden},
+		{http.MethodGet, "/api/x/../debug/vars", afuera, http.StatusForbidden},
+		{http.MethodGet, "/admin;x/usuarios", planta, http.StatusOK},
+
+		// El grupo de comandos solo aplica a los métodos que lista
+		{http.MethodPost, "/api/actuadores;x/5/activar", afuera, http.StatusForbidden},
+		{http.MethodGet, "/api/actuadores;x/5", afuera, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.RemoteAddr = tt.ip + ":4000"
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s desde %s: status %d, se esperaba %d", tt.method, tt.target, tt.ip, w.Code, tt.want)
+		}
+	}
+}
+
+func TestLoginFailuresBanOnThreshold(t *testing.T) {
+	for _, n := range []int{1, 3} {
+		t.Run("", func(t *testing.T) {
+			configureIPFilter(t, config.IPFilterConfig{
+				Ban: config.BanConfig{Duration: time.Minute, Window: time.Minute, LoginFailures: n},
+			})
+			r := ipFilteredRouter()
+			ip := "203.0.113.7"
+
+			for i := 1; i <= n; i++ {
+				if _, ok := banned(ip); ok {
+					t.Fatalf("baneada con %d de %d fallos", i-1, n)
+				}
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+				c.Request.RemoteAddr = ip + ":4000"
+				LoginFailed(c)
+			}
+			b, ok := banned(ip)
+			if !ok || b.Reason != BanLoginFailures {
+				t.Fatalf("al llegar a %d fallos debía banearse: %+v, %v", n, b, ok)
+			}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+			req.RemoteAddr = ip + ":4000"
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden || w.Header().Get("Retry-After") == "" {
+				t.Errorf("baneada: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestExemptNetworksAreNeverBanned(t *testing.T) {
+	configureIPFilter(t, config.IPFilterConfig{
+		Ban: config.BanConfig{Duration: time.Minute, Window: time.Minute, LoginFailures: 1, Exempt: []string{"10.0.0.0/8"}},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	c.Request.RemoteAddr = "10.1.2.3:4000"
+	LoginFailed(c)
+	if _, ok := banned("10.1.2.3"); ok {
+		t.Fatal("una red exenta no debía banearse")
+	}
+}
+
+func TestExpiredBansAreSwept(t *testing.T) {
+	configureIPFilter(t, config.IPFilterConfig{})
+
+	// IPs que no vuelven: banned() nunca las consulta
+	bansMu.Lock()
+	bans["203.0.113.1"] = Ban{IP: "203.0.113.1", Until: time.Now().Add(-time.Second)}
+	bans["203.0.113.2"] = Ban{IP: "203.0.113.2", Until: time.Now().Add(time.Minute)}
+	bansMu.Unlock()
+
+	ConfigureIPFilter(config.IPFilterConfig{})
+
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	if _, ok := bans["203.0.113.1"]; ok {
+		t.Error("el baneo vencido debía descartarse en el reload")
+	}
+	if _, ok := bans["203.0.113.2"]; !ok {
+		t.Error("el baneo vigente no debía tocarse")
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"gateway/auth"
+	"gateway/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LangKey es la clave del contexto Gin con el idioma de la petición (para templates).
+const LangKey = "lang"
+
+// -------------------------
+// Idioma (es/en)
+// -------------------------
+// Elige el idioma de la petición: ?lang= (que además queda en la cookie),
+// la cookie de idioma (donde vive la preferencia del usuario) o
+// Accept-Language. Va primero para que cualquier error salga traducido.
+func LocaleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		lang, ok := i18n.Parse(c.Query("lang"))
+		if ok {
+			auth.SetLangCookie(c.Writer, lang)
+		} else if lang, ok = i18n.Parse(auth.LangFromCookie(c.Request)); !ok {
+			lang = i18n.Negotiate(c.GetHeader("Accept-Language"))
+		}
+
+		c.Request = c.Request.WithContext(i18n.WithLang(c.Request.Context(), lang))
+		c.Set(LangKey, lang)
+		c.Next()
+	}
+}
+
+// Lang devuelve el idioma de la petición.
+func Lang(c *gin.Context) string {
+	if lang := c.GetString(LangKey); lang != "" {
+		return lang
+	}
+	return i18n.FromRequest(c.Request)
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gateway/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("gateway_http_requests_total",
+		"Peticiones atendidas por el gateway.", "route", "method", "status")
+	httpDuration = metrics.NewHistogramVec("gateway_http_request_duration_seconds",
+		"Latencia de las peticiones, desde que llegan hasta que se responden.", nil, "route", "method", "status")
+)
+
+// -------------------------
+// Métricas por petición
+// -------------------------
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+		c.Next()
+
+		route := routeLabel(c)
+		method := metricMethod(c.Request.Method)
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.Inc(route, method, status)
+		httpDuration.Observe(time.Since(start).Seconds(), route, method, status)
+	}
+}
+
+// routeLabel es el nombre de la ruta de la tabla para lo que se reenvía, o el
+// patrón de Gin (p.ej. /admin/bans/:ip) para las rutas propias; nunca el path
+// tal cual, que dispararía la cantidad de series (y de nombres de span).
+func routeLabel(c *gin.Context) string {
+	if route := c.GetString(RouteKey); route != "" {
+		return route
+	}
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// metricMethod acota el método a los estándar: el cliente puede mandar cualquiera.
+func metricMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
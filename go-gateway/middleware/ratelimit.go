@@ -0,0 +1,355 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gateway/auth"
+	"gateway/clientip"
+	"gateway/config"
+	"gateway/metrics"
+	"gateway/problem"
+	"gateway/proxy"
+	"gateway/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader es el header del que sale la parte "api_key" de las claves.
+const APIKeyHeader = "X-API-Key"
+
+var (
+	rlMu      sync.RWMutex
+	rlStore   ratelimit.Store
+	rlCfg     config.RateLimitStoreConfig
+	limiter   ratelimit.Limiter
+	policies  = map[string]*policy{}
+	endpoints = map[string][]string{}
+	rlErrLog  atomic.Int64 // último log de error del store (unix), para no inundar el log
+
+	rateLimited = metrics.NewCounterVec("gateway_ratelimit_rejections_total",
+		"Peticiones rechazadas por rate limit, por política (global = límite general por IP).", "policy")
+)
+
+// policy es una política de rate_limit.policies lista para usar.
+type policy struct {
+	name    string
+	key     []string
+	limiter ratelimit.Limiter
+}
+
+// Configure aplica la configuración del rate limit. El store se conserva
+// entre recargas mientras su configuración no cambie, así los contadores
+// siguen valiendo.
+func Configure(cfg config.RateLimitConfig) {
+	rlMu.Lock()
+	defer rlMu.Unlock()
+
+	if rlStore == nil || cfg.Store != rlCfg {
+		if rlStore != nil {
+			rlStore.Close()
+		}
+		rlStore = ratelimit.NewStore(cfg.Store)
+		rlCfg = cfg.Store
+		slog.Info("rate limit: store configurado", "backend", cfg.Store.Backend)
+	}
+
+	limiter = ratelimit.New(cfg.Algorithm, rlStore, ratelimit.Limit{
+		Requests: cfg.RequestsPerMinute,
+		Period:   time.Minute,
+		Burst:    cfg.Burst,
+	})
+	policies = map[string]*policy{}
+	for name, p := range cfg.Policies {
+		policies[name] = &policy{
+			name: name,
+			key:  p.Key,
+			limiter: ratelimit.New(p.Algorithm, rlStore, ratelimit.Limit{
+				Requests: p.Requests,
+				Period:   p.Period,
+				Burst:    p.Burst,
+			}),
+		}
+	}
+	endpoints = cfg.Endpoints
+}
+
+func globalLimiter() ratelimit.Limiter {
+	rlMu.RLock()
+	defer rlMu.RUnlock()
+	return limiter
+}
+
+// -------------------------
+// Versión de Rate Limit para Gin
+// -------------------------
+// Rutas propias del gateway: las políticas de rate_limit.endpoints si el path
+// tiene, y si no el límite general por IP. Lo que no es una ruta propia
+// (NoRoute) lo limita ProxyHandler según la ruta de la tabla.
+func RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		rlMu.RLock()
+		names := endpoints[c.Request.URL.Path]
+		rlMu.RUnlock()
+		if !AllowRoute(c, names, c.Request.URL.Path, nil) {
+			problem.Abort(c, problem.RateLimited, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AllowGlobal cuenta la petición contra el límite general por IP.
+func AllowGlobal(c *gin.Context) bool {
+	return allow(c, globalPolicy, globalLimiter(), "ip|"+clientip.FromRequest(c.Request))
+}
+
+// AllowRoute aplica las políticas propias de una ruta o endpoint (names) o,
+// si no tiene, el límite general: una ruta con rate_limits lo reemplaza, así
+// "ingesta" puede permitir más que los requests_per_minute por IP.
+func AllowRoute(c *gin.Context, names []string, route string, claims *auth.AccessClaims) bool {
+	if len(names) == 0 {
+		return AllowGlobal(c)
+	}
+	return AllowPolicies(c, names, route, claims)
+}
+
+// -------------------------
+// Políticas por ruta
+// -------------------------
+// AllowPolicies cuenta la petición contra cada política de names (route es
+// el nombre de la ruta, para la parte "route" de la clave) y devuelve false
+// si alguna ya se superó. claims puede ser nil: si una política usa "sub" se
+// lee el access token, si hay. Una política desconocida no limita.
+func AllowPolicies(c *gin.Context, names []string, route string, claims *auth.AccessClaims) bool {
+	for _, name := range names {
+		rlMu.RLock()
+		p, ok := policies[name]
+		rlMu.RUnlock()
+		if !ok {
+			continue
+		}
+		if claims == nil && slices.Contains(p.key, config.KeySub) {
+			claims = SessionClaims(c)
+		}
+		if !allow(c, p.name, p.limiter, policyKey(c, p, route, claims)) {
+			return false
+		}
+	}
+	return true
+}
+
+// policyKey arma la clave de p para la petición, p.ej.
+// "login|ip=10.0.0.7" o "ingesta|device_id=42|route=python".
+func policyKey(c *gin.Context, p *policy, route string, claims *auth.AccessClaims) string {
+	parts := []string{p.name}
+	for _, k := range p.key {
+		v := ""
+		switch k {
+		case config.KeySub:
+			if claims != nil {
+				v = claims.UID
+			}
+		case config.KeyAPIKey:
+			if key := c.GetHeader(APIKeyHeader); key != "" {
+				// La clave no se guarda tal cual en el store (puede ser Redis compartido)
+				sum := sha256.Sum256([]byte(key))
+				v = hex.EncodeToString(sum[:12])
+			}
+		case config.KeyDeviceID:
+			v, _ = proxy.LookupDeviceID(c.Request)
+		case config.KeyRoute:
+			v = route
+		}
+		if v == "" {
+			k, v = config.KeyIP, clientip.FromRequest(c.Request)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, "|")
+}
+
+// allow consulta el limiter de la política name. Si el store falla (p.ej.
+// Redis caído) la petición pasa: el rate limit no debe tirar abajo el gateway.
+// Una clave tan disputada que no se pudo actualizar sí se rechaza: es un
+// cliente en ráfaga.
+func allow(c *gin.Context, name string, l ratelimit.Limiter, key string) bool {
+	if l == nil {
+		return true
+	}
+	res, err := l.Allow(c.Request.Context(), key)
+	if errors.Is(err, ratelimit.ErrConflict) {
+		c.Header("Retry-After", "1")
+		rateLimited.Inc(name)
+		return false
+	}
+	if err != nil {
+		if now := time.Now().Unix(); rlErrLog.Swap(now) != now {
+			slog.WarnContext(c.Request.Context(), "rate limit: store no disponible, se deja pasar", "error", err)
+		}
+		return true
+	}
+	report(c, l.Limit(), res)
+	if !res.Allowed {
+		rateLimited.Inc(name)
+		strike(c, BanRateLimited)
+	}
+	return res.Allowed
+}
+
+// -------------------------
+// Headers RateLimit-* (draft-ietf-httpapi-ratelimit-headers)
+// -------------------------
+
+const (
+	headerLimit     = "RateLimit-Limit"
+	headerRemaining = "RateLimit-Remaining"
+	headerReset     = "RateLimit-Reset"
+	headerPolicy    = "RateLimit-Policy"
+)
+
+// quotaKey guarda en el contexto Gin la cuota que se publicó en los headers.
+const quotaKey = "ratelimit_quota"
+
+// report publica la cuota más cercana a agotarse de las que se evaluaron en
+// la petición (límite general y políticas) y, si se rechazó, Retry-After.
+func report(c *gin.Context, lim ratelimit.Limit, res ratelimit.Result) {
+	if prev, ok := c.Get(quotaKey); ok && res.Allowed && prev.(ratelimit.Result).Remaining <= res.Remaining {
+		return
+	}
+	c.Set(quotaKey, res)
+
+	c.Header(headerLimit, strconv.Itoa(res.Limit))
+	c.Header(headerRemaining, strconv.Itoa(res.Remaining))
+	c.Header(headerReset, ceilSeconds(res.Reset))
+	c.Header(headerPolicy, policyHeader(lim))
+	if !res.Allowed {
+		c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+	}
+}
+
+// policyHeader describe el límite: "60;w=60", o "60;w=60;burst=10".
+func policyHeader(lim ratelimit.Limit) string {
+	v := fmt.Sprintf("%d;w=%d", lim.Requests, int(lim.Period.Seconds()))
+	if lim.Burst > 0 {
+		v += fmt.Sprintf(";burst=%d", lim.Burst)
+	}
+	return v
+}
+
+// ceilSeconds redondea hacia arriba: los headers van en segundos enteros.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
+
+// -------------------------
+// Consumo del cliente (GET /me/quota)
+// -------------------------
+
+// Quota es el estado de una política para quien consulta.
+type Quota struct {
+	Policy string   `json:"policy"`
+	Key    []string `json:"key"`
+	// Route solo aparece si la clave incluye la ruta (hay una cuota por ruta)
+	Route     string `json:"route,omitempty"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Window    int    `json:"window_seconds"`
+	Reset     int    `json:"reset_seconds"`
+	Limited   bool   `json:"limited"`
+	// RetryAfter solo si Limited
+	RetryAfter int `json:"retry_after_seconds,omitempty"`
+}
+
+// globalPolicy es el nombre con el que aparece el límite general por IP.
+const globalPolicy = "global"
+
+// Quotas devuelve el consumo de la petición en el límite general y en cada
+// política en uso (por las rutas de routes o por rate_limit.endpoints), sin
+// consumir cuota.
+func Quotas(c *gin.Context, claims *auth.AccessClaims, routes []config.RouteConfig) ([]Quota, error) {
+	rlMu.RLock()
+	uses := map[string][]string{}
+	for path, names := range endpoints {
+		for _, name := range names {
+			uses[name] = append(uses[name], path)
+		}
+	}
+	ps := policies
+	global := limiter
+	rlMu.RUnlock()
+	for _, r := range routes {
+		for _, name := range r.RateLimits {
+			uses[name] = append(uses[name], r.Name)
+		}
+	}
+
+	out := []Quota{}
+	q, err := peek(c, globalPolicy, []string{config.KeyIP}, "", global, "ip|"+clientip.FromRequest(c.Request))
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, q)
+
+	names := make([]string, 0, len(uses))
+	for name := range uses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := ps[name]
+		if !ok {
+			continue
+		}
+		// Sin "route" en la clave todas las rutas comparten la misma cuota
+		routeNames := []string{""}
+		if slices.Contains(p.key, config.KeyRoute) {
+			routeNames = uses[name]
+			sort.Strings(routeNames)
+		}
+		for _, route := range routeNames {
+			q, err := peek(c, name, p.key, route, p.limiter, policyKey(c, p, route, claims))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+func peek(c *gin.Context, name string, key []string, route string, l ratelimit.Limiter, storeKey string) (Quota, error) {
+	res, err := l.Peek(c.Request.Context(), storeKey)
+	if err != nil {
+		return Quota{}, err
+	}
+	q := Quota{
+		Policy:    name,
+		Key:       key,
+		Route:     route,
+		Limit:     res.Limit,
+		Remaining: res.Remaining,
+		Window:    int(l.Limit().Period.Seconds()),
+		Reset:     int((res.Reset + time.Second - 1) / time.Second),
+		Limited:   !res.Allowed,
+	}
+	if q.Limited {
+		q.RetryAfter = int((res.RetryAfter + time.Second - 1) / time.Second)
+	}
+	return q, nil
+}
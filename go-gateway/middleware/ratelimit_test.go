@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gateway/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func rateLimitedRouter(t *testing.T, store config.RateLimitStoreConfig) *gin.Engine {
+	return rateLimitedRouterWith(t, config.RateLimitConfig{
+		Algorithm:         config.AlgorithmTokenBucket,
+		RequestsPerMinute: 2,
+		Store:             store,
+	})
+}
+
+func rateLimitedRouterWith(t *testing.T, cfg config.RateLimitConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	Configure(cfg)
+	// El store se conserva entre Configure iguales: cada test empieza con uno nuevo
+	t.Cleanup(func() {
+		rlMu.Lock()
+		defer rlMu.Unlock()
+		rlStore.Close()
+		rlStore, limiter, policies, endpoints = nil, nil, map[string]*policy{}, map[string][]string{}
+	})
+
+	r := gin.New()
+	r.Use(RateLimitMiddleware())
+	r.GET("/x", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func statuses(r http.Handler, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/x", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		r.ServeHTTP(w, req)
+		out[i] = w.Code
+	}
+	return out
+}
+
+func TestRateLimitRejectsOverLimit(t *testing.T) {
+	r := rateLimitedRouter(t, config.RateLimitStoreConfig{Backend: config.BackendMemory})
+
+	got := statuses(r, 3)
+	if got[0] != http.StatusOK || got[1] != http.StatusOK || got[2] != http.StatusTooManyRequests {
+		t.Fatalf("status = %v, se esperaba [200 200 429]", got)
+	}
+}
+
+func TestAlgorithmChangeOnReloadStartsFresh(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Algorithm:         config.AlgorithmTokenBucket,
+		RequestsPerMinute: 2,
+		Store:             config.RateLimitStoreConfig{Backend: config.BackendMemory},
+	}
+	r := rateLimitedRouterWith(t, cfg)
+	statuses(r, 3)
+
+	// El store se conserva, pero el sliding log no debe leer el estado del
+	// token bucket como si fueran marcas suyas (ni al revés)
+	for _, algorithm := range []string{config.AlgorithmSlidingLog, config.AlgorithmTokenBucket} {
+		cfg.Algorithm = algorithm
+		Configure(cfg)
+		got := statuses(r, 3)
+		if algorithm == config.AlgorithmTokenBucket {
+			// Su propio estado sigue agotado
+			if got[0] != http.StatusTooManyRequests {
+				t.Errorf("%s: status = %v, el bucket anterior debía seguir agotado", algorithm, got)
+			}
+			continue
+		}
+		if got[0] != http.StatusOK || got[1] != http.StatusOK || got[2] != http.StatusTooManyRequests {
+			t.Errorf("%s: status = %v, se esperaba [200 200 429]", algorithm, got)
+		}
+	}
+}
+
+func TestRateLimitFailsOpenWhenRedisIsDown(t *testing.T) {
+	// Un puerto que estuvo abierto y ya no escucha
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	r := rateLimitedRouter(t, config.RateLimitStoreConfig{
+		Backend: config.BackendRedis,
+		Redis:   config.RateLimitRedisConfig{Addr: addr, Timeout: 100 * time.Millisecond, PoolSize: 1},
+	})
+
+	// Sin store no se limita: pasan más que las 2 por minuto
+	for i, code := range statuses(r, 5) {
+		if code != http.StatusOK {
+			t.Fatalf("petición %d: status %d, se esperaba 200 con Redis caído", i, code)
+		}
+	}
+}
+
+func TestEndpointPoliciesReplaceGlobalLimit(t *testing.T) {
+	r := rateLimitedRouterWith(t, config.RateLimitConfig{
+		Algorithm:         config.AlgorithmTokenBucket,
+		RequestsPerMinute: 2,
+		Policies: map[string]config.RateLimitPolicy{
+			"holgada": {Requests: 4, Period: time.Minute, Key: []string{config.KeyIP}},
+		},
+		Endpoints: map[string][]string{"/x": {"holgada"}},
+		Store:     config.RateLimitStoreConfig{Backend: config.BackendMemory},
+	})
+
+	// Cuenta solo la política del endpoint: 4 y no las 2 del límite general
+	got := statuses(r, 5)
+	for i, code := range got[:4] {
+		if code != http.StatusOK {
+			t.Fatalf("petición %d: status %d (%v)", i, code, got)
+		}
+	}
+	if got[4] != http.StatusTooManyRequests {
+		t.Fatalf("la quinta debía rechazarse: %v", got)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"gateway/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDKey es la clave del contexto Gin con el ID de la petición.
+const RequestIDKey = "request_id"
+
+// -------------------------
+// X-Request-ID
+// -------------------------
+// Acepta el ID del cliente (o del proxy de adelante) si es válido y si no
+// genera uno. Queda en el header de la petición, así el proxy lo reenvía al
+// upstream, y en la respuesta. Va primero para que todo lo registre.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Request.Header.Set(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.WithID(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+		c.Set(RequestIDKey, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gateway/auth"
+	"gateway/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// -------------------------
+// Token del request (header Bearer o cookie)
+// -------------------------
+func AccessToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return header[7:]
+	}
+	return auth.AccessTokenFromCookie(c.Request)
+}
+
+// ClaimsMiddleware valida una sola vez el access token de la petición (si
+// hay) y deja los claims en ClaimsKey para el resto de la cadena y el log de
+// accesos. Un token inválido no corta nada: cada ruta decide si lo exige.
+func ClaimsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := AccessToken(c); token != "" {
+			if claims, err := auth.ParseAccessToken(token); err == nil {
+				c.Set(ClaimsKey, claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// SessionClaims devuelve los claims que dejó ClaimsMiddleware, o nil.
+func SessionClaims(c *gin.Context) *auth.AccessClaims {
+	v, _ := c.Get(ClaimsKey)
+	claims, _ := v.(*auth.AccessClaims)
+	return claims
+}
+
+// UsesBearer indica si el cliente se autentica con header (API) y no con cookie.
+func UsesBearer(c *gin.Context) bool {
+	return strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// RequireSameOrigin rechaza las peticiones que el navegador marca como de otro
+// sitio (Sec-Fetch-Site). Sin el header (clientes que no son navegadores) pasan.
+func RequireSameOrigin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetHeader("Sec-Fetch-Site") {
+		case "", "same-origin", "none":
+			c.Next()
+		default:
+			problem.Abort(c, problem.CSRFInvalid, "")
+		}
+	}
+}
+
+// RedirectToSilentRefresh manda al navegador a /refresh, que renueva la sesión
+// con la cookie de refresh y vuelve (307) a la URL original.
+func RedirectToSilentRefresh(c *gin.Context) {
+	c.Redirect(http.StatusTemporaryRedirect, "/refresh?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+	c.Abort()
+}
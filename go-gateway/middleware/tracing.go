@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"gateway/clientip"
+	"gateway/requestid"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("gateway/middleware")
+
+// -------------------------
+// Span de servidor por petición
+// -------------------------
+// Continúa la traza del traceparent que llega (o empieza una) y deja el span
+// en el contexto de la petición: de ahí cuelgan los spans del proxy y de
+// Firebase, y los logs toman trace_id. El nombre se completa al final, cuando
+// ya se sabe qué ruta atendió la petición.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		method := metricMethod(c.Request.Method)
+		ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLPath(c.Request.URL.Path),
+			semconv.ClientAddress(clientip.FromRequest(c.Request)),
+			semconv.UserAgentOriginal(c.Request.UserAgent()),
+			attribute.String("request.id", requestid.FromContext(ctx)),
+		))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		route := routeLabel(c)
+		status := c.Writer.Status()
+		span.SetName(method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package problem define el formato único de los errores que genera el propio
+// gateway: application/problem+json (RFC 7807) con un código estable en
+// "type", título traducido (ver i18n) y el ID de la petición.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gateway/i18n"
+	"gateway/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType de las respuestas de error.
+const ContentType = "application/problem+json"
+
+// typePrefix antepone el código en "type". Es un URN: estable, no se resuelve.
+const typePrefix = "urn:problem:gateway:"
+
+// Problem es el cuerpo de todas las respuestas de error del gateway.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+// Code es el identificador estable de un tipo de error. Los clientes deben
+// decidir según el código, nunca según el título o el detalle.
+type Code string
+
+const (
+	InvalidRequest         Code = "invalid_request"
+	MethodNotAllowed       Code = "method_not_allowed"
+	NotFound               Code = "not_found"
+	Unauthorized           Code = "unauthorized"
+	InvalidToken           Code = "invalid_token"
+	InvalidCredentials     Code = "invalid_credentials"
+	SessionExpired         Code = "session_expired"
+	Forbidden              Code = "forbidden"
+	ImpersonationForbidden Code = "impersonation_forbidden"
+	CSRFInvalid            Code = "csrf_invalid"
+	EmailExists            Code = "email_exists"
+	RateLimited            Code = "rate_limited"
+	IPForbidden            Code = "ip_forbidden"
+	IPBanned               Code = "ip_banned"
+	Internal               Code = "internal"
+	BadGateway             Code = "bad_gateway"
+	UpstreamUnavailable    Code = "upstream_unavailable"
+	CircuitOpen            Code = "circuit_open"
+	Overloaded             Code = "overloaded"
+	UpstreamTimeout        Code = "upstream_timeout"
+	AuditUnavailable       Code = "audit_unavailable"
+)
+
+var statuses = map[Code]int{
+	InvalidRequest:         http.StatusBadRequest,
+	MethodNotAllowed:       http.StatusMethodNotAllowed,
+	NotFound:               http.StatusNotFound,
+	Unauthorized:           http.StatusUnauthorized,
+	InvalidToken:           http.StatusUnauthorized,
+	InvalidCredentials:     http.StatusUnauthorized,
+	SessionExpired:         http.StatusUnauthorized,
+	Forbidden:              http.StatusForbidden,
+	ImpersonationForbidden: http.StatusForbidden,
+	CSRFInvalid:            http.StatusForbidden,
+	EmailExists:            http.StatusConflict,
+	RateLimited:            http.StatusTooManyRequests,
+	IPForbidden:            http.StatusForbidden,
+	IPBanned:               http.StatusForbidden,
+	Internal:               http.StatusInternalServerError,
+	BadGateway:             http.StatusBadGateway,
+	UpstreamUnavailable:    http.StatusServiceUnavailable,
+	CircuitOpen:            http.StatusServiceUnavailable,
+	Overloaded:             http.StatusServiceUnavailable,
+	UpstreamTimeout:        http.StatusGatewayTimeout,
+	AuditUnavailable:       http.StatusServiceUnavailable,
+}
+
+// Status devuelve el código HTTP asociado a code.
+func (code Code) Status() int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// New arma el problema para la petición r, con título y detalle en su idioma.
+// detail es una key del catálogo (detail.*) formateada con args; un texto que
+// no está en el catálogo se usa tal cual.
+func New(r *http.Request, code Code, detail string, args ...interface{}) *Problem {
+	status, ok := statuses[code]
+	if !ok {
+		code, status = Internal, statuses[Internal]
+	}
+	lang := i18n.FromRequest(r)
+	p := &Problem{
+		Type:     typePrefix + string(code),
+		Title:    i18n.T(lang, "problem."+string(code)),
+		Status:   status,
+		Instance: r.URL.Path,
+	}
+	if detail != "" {
+		p.Detail = i18n.T(lang, detail, args...)
+	}
+	return p
+}
+
+// Write responde con el problema de code. detail es opcional y no debe llevar
+// errores internos crudos (de Firebase, de red...): esos van al log.
+func Write(w http.ResponseWriter, r *http.Request, code Code, detail string, args ...interface{}) {
+	p := New(r, code, detail, args...)
+	p.RequestID = RequestID(w, r)
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Abort responde con el problema de code y corta la cadena de handlers de gin.
+func Abort(c *gin.Context, code Code, detail string, args ...interface{}) {
+	Write(c.Writer, c.Request, code, detail, args...)
+	c.Abort()
+}
+
+// RequestID devuelve el ID de la petición (ver requestid) y se asegura de que
+// la respuesta lo lleve. Si la petición no pasó por RequestIDMiddleware se
+// genera uno.
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	id := requestid.FromContext(r.Context())
+	if id == "" {
+		if id = w.Header().Get(requestid.Header); id == "" {
+			id = requestid.New()
+		}
+	}
+	w.Header().Set(requestid.Header, id)
+	return id
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gateway/config"
+)
+
+// Target es una instancia de un upstream.
+type Target struct {
+	URL    *url.URL
+	Weight int
+
+	// state sobrevive a los reloads: la tabla nueva hereda el de la anterior
+	// para la misma instancia (ver NewTable)
+	state *targetState
+}
+
+// Active devuelve las peticiones en curso hacia el target.
+func (t *Target) Active() int64 {
+	return t.state.active.Load()
+}
+
+// Balancer elige un target para una petición (nil si no hay ninguno disponible).
+type Balancer interface {
+	Pick(req *http.Request) *Target
+}
+
+// Pool son las instancias de un upstream junto con su estrategia de balanceo.
+// Las rutas que comparten upstream comparten el pool.
+type Pool struct {
+	Name     string
+	Strategy string
+	Targets  []*Target
+
+	Breaker *Breaker
+
+	cfg      config.UpstreamConfig
+	balancer Balancer
+	stop     context.CancelFunc // detiene los chequeos activos
+	// cambios sobre el estado heredado de prev, que se aplican en Commit
+	pending []func()
+}
+
+// NewPool construye el pool de un upstream según su configuración. Si prev no
+// es nil, las instancias que ya estaban en prev conservan su estado de salud y
+// el pool conserva su circuit breaker. Ese estado es compartido con prev, que
+// sigue atendiendo: la config nueva se le aplica recién en Commit.
+func NewPool(name string, cfg config.UpstreamConfig, prev *Pool) (*Pool, error) {
+	p := &Pool{Name: name, Strategy: cfg.Strategy, cfg: cfg}
+	if p.Strategy == "" {
+		p.Strategy = config.StrategyRoundRobin
+	}
+	for _, tc := range cfg.AllTargets() {
+		u, err := url.Parse(tc.URL)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", name, err)
+		}
+		t := &Target{URL: u, Weight: tc.Weight}
+		if old := prev.target(u.String()); old != nil {
+			t.state = old.state
+			if cfg.HealthCheck.Path == "" {
+				p.pending = append(p.pending, t.state.withoutActiveCheck)
+			}
+		} else {
+			// Con chequeo activo la instancia no recibe tráfico hasta el primer OK
+			t.state = newTargetState(cfg.HealthCheck.Path == "")
+		}
+		p.Targets = append(p.Targets, t)
+	}
+	if len(p.Targets) == 0 {
+		return nil, fmt.Errorf("upstream %s: sin targets", name)
+	}
+	if prev != nil {
+		p.Breaker = prev.Breaker
+		p.pending = append(p.pending, func() { p.Breaker.configure(cfg.CircuitBreaker) })
+	} else {
+		p.Breaker = newBreaker(name, cfg.CircuitBreaker)
+	}
+
+	switch p.Strategy {
+	case config.StrategyRoundRobin:
+		p.balancer = newRoundRobin(p.Targets)
+	case config.StrategyLeastConnections:
+		p.balancer = &leastConnections{targets: p.Targets}
+	case config.StrategyConsistentHash:
+		p.balancer = newConsistentHash(p.Targets)
+	default:
+		return nil, fmt.Errorf("upstream %s: strategy %q desconocida", name, p.Strategy)
+	}
+	return p, nil
+}
+
+// Commit aplica la config nueva al estado heredado de prev. Se llama una vez,
+// cuando el pool ya no puede descartarse.
+func (p *Pool) Commit() {
+	for _, fn := range p.pending {
+		fn()
+	}
+	p.pending = nil
+}
+
+// Pick elige el target para la petición.
+func (p *Pool) Pick(req *http.Request) *Target {
+	return p.balancer.Pick(req)
+}
+
+func (p *Pool) target(u string) *Target {
+	if p == nil {
+		return nil
+	}
+	for _, t := range p.Targets {
+		if t.URL.String() == u {
+			return t
+		}
+	}
+	return nil
+}
+
+// -------------------------
+// Round robin ponderado (smooth weighted, como nginx)
+// -------------------------
+type roundRobin struct {
+	mu      sync.Mutex
+	targets []*Target
+	current []int
+}
+
+func newRoundRobin(targets []*Target) *roundRobin {
+	return &roundRobin{targets: targets, current: make([]int, len(targets))}
+}
+
+func (rr *roundRobin) Pick(_ *http.Request) *Target {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	total := 0
+	best := -1
+	for i, t := range rr.targets {
+		if !t.Available() {
+			continue
+		}
+		rr.current[i] += t.Weight
+		total += t.Weight
+		if best == -1 || rr.current[i] > rr.current[best] {
+			best = i
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+	rr.current[best] -= total
+	return rr.targets[best]
+}
+
+// -------------------------
+// Menos conexiones (relativo al peso)
+// -------------------------
+type leastConnections struct {
+	targets []*Target
+}
+
+func (lc *leastConnections) Pick(_ *http.Request) *Target {
+	var best *Target
+	for _, t := range lc.targets {
+		if !t.Available() {
+			continue
+		}
+		// active/weight comparado sin divisiones
+		if best == nil || t.Active()*int64(best.Weight) < best.Active()*int64(t.Weight) {
+			best = t
+		}
+	}
+	return best
+}
+
+// -------------------------
+// Hash consistente por ID de dispositivo
+// -------------------------
+// Cada target ocupa Weight*replicasPerWeight puntos del anillo, así que las
+// peticiones de un mismo dispositivo van siempre a la misma instancia mientras
+// esté disponible, y al caer una solo se reparten sus dispositivos.
+const replicasPerWeight = 100
+
+type ringPoint struct {
+	hash   uint32
+	target *Target
+}
+
+type consistentHash struct {
+	ring []ringPoint
+}
+
+func newConsistentHash(targets []*Target) *consistentHash {
+	ch := &consistentHash{}
+	for _, t := range targets {
+		for i := 0; i < t.Weight*replicasPerWeight; i++ {
+			h := crc32.ChecksumIEEE([]byte(t.URL.String() + "#" + strconv.Itoa(i)))
+			ch.ring = append(ch.ring, ringPoint{hash: h, target: t})
+		}
+	}
+	sort.Slice(ch.ring, func(i, j int) bool { return ch.ring[i].hash < ch.ring[j].hash })
+	return ch
+}
+
+func (ch *consistentHash) Pick(req *http.Request) *Target {
+	if len(ch.ring) == 0 {
+		return nil
+	}
+	h := crc32.ChecksumIEEE([]byte(DeviceID(req)))
+	start := sort.Search(len(ch.ring), func(i int) bool { return ch.ring[i].hash >= h })
+	for i := 0; i < len(ch.ring); i++ {
+		p := ch.ring[(start+i)%len(ch.ring)]
+		if p.target.Available() {
+			return p.target
+		}
+	}
+	return nil
+}
+
+// DeviceID obtiene el ID de dispositivo de la petición (ver LookupDeviceID).
+// Sin ID usa el path.
+func DeviceID(req *http.Request) string {
+	if id, ok := LookupDeviceID(req); ok {
+		return id
+	}
+	return req.URL.Path
+}
+
+// LookupDeviceID busca el ID de dispositivo: header X-Device-ID, query
+// dispositivoId/deviceId, o el primer segmento numérico del path
+// (/api/dispositivos/42, /api/actuadores/7/activar).
+func LookupDeviceID(req *http.Request) (string, bool) {
+	if id := req.Header.Get("X-Device-ID"); id != "" {
+		return id, true
+	}
+	q := req.URL.Query()
+	for _, k := range []string{"dispositivoId", "deviceId", "device_id"} {
+		if id := q.Get(k); id != "" {
+			return id, true
+		}
+	}
+	for _, seg := range strings.Split(req.URL.Path, "/") {
+		if seg == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(seg, 10, 64); err == nil {
+			return seg, true
+		}
+	}
+	return "", false
+}
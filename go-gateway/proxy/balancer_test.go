@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// testTargets crea un target sano por peso, llamados a, b, c...
+func testTargets(weights ...int) []*Target {
+	out := make([]*Target, len(weights))
+	for i, w := range weights {
+		u, _ := url.Parse("http://" + string(rune('a'+i)) + ".local")
+		out[i] = &Target{URL: u, Weight: w, state: newTargetState(true)}
+	}
+	return out
+}
+
+func targetName(t *Target) string {
+	if t == nil {
+		return "-"
+	}
+	return t.URL.Hostname()[:1]
+}
+
+func setHealthy(t *Target, healthy bool) {
+	t.state.mu.Lock()
+	t.state.healthy = healthy
+	t.state.mu.Unlock()
+}
+
+func picks(b Balancer, n int) string {
+	out := ""
+	for i := 0; i < n; i++ {
+		out += targetName(b.Pick(httptest.NewRequest(http.MethodGet, "/", nil)))
+	}
+	return out
+}
+
+func TestRoundRobinSmoothWeights(t *testing.T) {
+	targets := testTargets(5, 1, 1)
+	rr := newRoundRobin(targets)
+
+	// Como nginx: el de más peso no recibe sus 5 seguidas
+	if got := picks(rr, 14); got != "aabacaa"+"aabacaa" {
+		t.Fatalf("secuencia = %q", got)
+	}
+
+	setHealthy(targets[0], false)
+	if got := picks(rr, 4); got != "bcbc" {
+		t.Errorf("sin a: %q", got)
+	}
+	setHealthy(targets[1], false)
+	setHealthy(targets[2], false)
+	if got := rr.Pick(nil); got != nil {
+		t.Errorf("sin instancias disponibles: %s", targetName(got))
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		active  []int64
+		down    int // índice no disponible, -1 ninguno
+		want    string
+	}{
+		{"menos activas", []int{1, 1, 1}, []int64{3, 1, 2}, -1, "b"},
+		{"empate: la primera", []int{1, 1, 1}, []int64{2, 2, 2}, -1, "a"},
+		{"relativo al peso", []int{4, 1}, []int64{6, 2}, -1, "a"},
+		{"relativo al peso, lleno", []int{4, 1}, []int64{9, 2}, -1, "b"},
+		{"salta las no disponibles", []int{1, 1}, []int64{5, 0}, 1, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := testTargets(tt.weights...)
+			for i, n := range tt.active {
+				targets[i].state.active.Store(n)
+			}
+			if tt.down >= 0 {
+				setHealthy(targets[tt.down], false)
+			}
+			lc := &leastConnections{targets: targets}
+			if got := targetName(lc.Pick(nil)); got != tt.want {
+				t.Errorf("Pick = %s, se esperaba %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsistentHashIsStickyAndMovesOnlyFailedDevices(t *testing.T) {
+	targets := testTargets(1, 1, 1)
+	ch := newConsistentHash(targets)
+
+	device := func(id int) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/lecturas", nil)
+		req.Header.Set("X-Device-ID", strconv.Itoa(id))
+		return req
+	}
+	const devices = 300
+	before := make([]*Target, devices)
+	count := map[string]int{}
+	for id := range before {
+		before[id] = ch.Pick(device(id))
+		count[targetName(before[id])]++
+		if again := ch.Pick(device(id)); again != before[id] {
+			t.Fatalf("dispositivo %d: %s y luego %s", id, targetName(before[id]), targetName(again))
+		}
+	}
+	// Reparto razonable: ninguna instancia queda con menos de la mitad de su parte
+	for _, tg := range targets {
+		if count[targetName(tg)] < devices/len(targets)/2 {
+			t.Errorf("reparto desparejo: %v", count)
+		}
+	}
+
+	// Al caer b solo se mueven sus dispositivos
+	setHealthy(targets[1], false)
+	for id, prev := range before {
+		got := ch.Pick(device(id))
+		switch {
+		case got == targets[1]:
+			t.Fatalf("dispositivo %d sigue yendo a b", id)
+		case prev != targets[1] && got != prev:
+			t.Errorf("dispositivo %d se movió de %s a %s sin que %s cayera", id, targetName(prev), targetName(got), targetName(prev))
+		}
+	}
+
+	for _, tg := range targets {
+		setHealthy(tg, false)
+	}
+	if got := ch.Pick(device(1)); got != nil {
+		t.Errorf("sin instancias disponibles: %s", targetName(got))
+	}
+}
+
+func TestLookupDeviceID(t *testing.T) {
+	tests := []struct {
+		target, header string
+		want           string
+		ok             bool
+	}{
+		{"/api/lecturas", "d-7", "d-7", true},
+		{"/api/lecturas?dispositivoId=9", "", "9", true},
+		{"/api/lecturas?deviceId=9", "", "9", true},
+		{"/api/lecturas?device_id=9", "", "9", true},
+		{"/api/actuadores/7/activar", "", "7", true},
+		{"/api/dispositivos/42?deviceId=9", "", "9", true},
+		{"/api/lecturas", "", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.header != "" {
+			req.Header.Set("X-Device-ID", tt.header)
+		}
+		if got, ok := LookupDeviceID(req); got != tt.want || ok != tt.ok {
+			t.Errorf("%s (header %q): %q, %v; se esperaba %q, %v", tt.target, tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
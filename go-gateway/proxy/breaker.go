@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gateway/config"
+)
+
+// Estados del circuit breaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breakerBuckets es la resolución de la ventana deslizante.
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// Breaker es el circuit breaker de un upstream. Como el estado de salud de las
+// instancias, sobrevive a los reloads (ver NewPool).
+type Breaker struct {
+	name string
+
+	mu       sync.Mutex
+	cfg      config.CircuitBreakerConfig
+	state    string
+	openedAt time.Time
+	buckets  [breakerBuckets]breakerBucket
+
+	// half-open: pruebas en curso y pruebas que salieron bien
+	trials    int
+	successes int
+
+	// Métricas
+	transitions map[string]uint64 // veces que se entró a cada estado
+	rejected    uint64
+}
+
+func newBreaker(name string, cfg config.CircuitBreakerConfig) *Breaker {
+	return &Breaker{
+		name:        name,
+		cfg:         cfg,
+		state:       BreakerClosed,
+		transitions: map[string]uint64{},
+	}
+}
+
+func (b *Breaker) configure(cfg config.CircuitBreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = cfg
+	if cfg.Disabled && b.state != BreakerClosed {
+		b.setState(BreakerClosed, "desactivado")
+	}
+}
+
+// Allow indica si una petición puede ir al upstream. Si no, devuelve cuánto
+// esperar antes de reintentar. Cada Allow aceptado debe cerrarse con done.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.Disabled {
+		return true, 0
+	}
+
+	if b.state == BreakerOpen {
+		wait := b.cfg.OpenDuration - time.Since(b.openedAt)
+		if wait > 0 {
+			b.rejected++
+			return false, wait
+		}
+		b.setState(BreakerHalfOpen, "fin de open_duration")
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			b.rejected++
+			return false, time.Second
+		}
+		b.trials++
+	}
+	return true, 0
+}
+
+// done registra el resultado de una petición aceptada por Allow. ignored es
+// para las que no dicen nada del upstream (p.ej. el cliente canceló).
+func (b *Breaker) done(failed, ignored bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.Disabled {
+		return
+	}
+	slow := latency >= b.cfg.SlowCallDuration
+
+	switch b.state {
+	case BreakerHalfOpen:
+		// Una prueba de un ciclo half-open anterior puede llegar tarde
+		if b.trials > 0 {
+			b.trials--
+		}
+		switch {
+		case ignored:
+		case failed || slow:
+			b.setState(BreakerOpen, "falló una petición de prueba")
+		default:
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenRequests {
+				b.setState(BreakerClosed, "pruebas exitosas")
+			}
+		}
+	case BreakerClosed:
+		if ignored {
+			return
+		}
+		bk := b.bucket(time.Now())
+		bk.total++
+		if failed {
+			bk.failures++
+		}
+		if slow {
+			bk.slow++
+		}
+		b.evaluate()
+	}
+}
+
+// bucket devuelve el bucket de now, reciclándolo si quedó fuera de la ventana.
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bk.start.Equal(start) {
+		*bk = breakerBucket{start: start}
+	}
+	return bk
+}
+
+// counts suma los buckets que caen dentro de la ventana.
+func (b *Breaker) counts() (total, failures, slow int) {
+	since := time.Now().Add(-b.cfg.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(since) {
+			total += bk.total
+			failures += bk.failures
+			slow += bk.slow
+		}
+	}
+	return
+}
+
+func (b *Breaker) evaluate() {
+	total, failures, slow := b.counts()
+	if total < b.cfg.MinRequests {
+		return
+	}
+	errRate := float64(failures) / float64(total)
+	slowRate := float64(slow) / float64(total)
+	switch {
+	case errRate >= b.cfg.ErrorRate:
+		b.setState(BreakerOpen, "tasa de errores %.0f%%", errRate*100)
+	case slowRate >= b.cfg.SlowCallRate:
+		b.setState(BreakerOpen, "tasa de llamadas lentas %.0f%%", slowRate*100)
+	}
+}
+
+func (b *Breaker) setState(state, reason string, args ...interface{}) {
+	if len(args) > 0 {
+		reason = fmt.Sprintf(reason, args...)
+	}
+	slog.Warn("circuit breaker: cambio de estado", "name", b.name, "from", b.state, "to", state, "reason", reason)
+	b.state = state
+	b.transitions[state]++
+	b.trials = 0
+	b.successes = 0
+	switch state {
+	case BreakerOpen:
+		b.openedAt = time.Now()
+	case BreakerClosed:
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+}
+
+// BreakerStatus es la foto del circuit breaker (página de estado y métricas).
+type BreakerStatus struct {
+	State       string            `json:"state"`
+	Transitions map[string]uint64 `json:"transitions"`
+	Rejected    uint64            `json:"rejected"`
+	Requests    int               `json:"window_requests"`
+	Failures    int               `json:"window_failures"`
+	Slow        int               `json:"window_slow"`
+}
+
+// Status devuelve el estado del breaker.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{State: b.state, Rejected: b.rejected, Transitions: map[string]uint64{}}
+	for k, v := range b.transitions {
+		st.Transitions[k] = v
+	}
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cfg.OpenDuration {
+		// Pasará a half-open con la próxima petición
+		st.State = BreakerHalfOpen
+	}
+	st.Requests, st.Failures, st.Slow = b.counts()
+	return st
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func testBreaker() *Breaker {
+	return newBreaker("a", config.CircuitBreakerConfig{
+		Window:           time.Minute,
+		MinRequests:      4,
+		ErrorRate:        0.5,
+		SlowCallDuration: time.Second,
+		SlowCallRate:     0.5,
+		OpenDuration:     20 * time.Millisecond,
+		HalfOpenRequests: 2,
+	})
+}
+
+// attempt pasa una petición por el breaker; false si la rechazó.
+func attempt(b *Breaker, failed bool, latency time.Duration) bool {
+	ok, _ := b.Allow()
+	if ok {
+		b.done(failed, false, latency)
+	}
+	return ok
+}
+
+func TestBreakerOpens(t *testing.T) {
+	tests := []struct {
+		name string
+		// resultados en orden: 'o' ok, 'f' fallo, 's' lenta, 'i' ignorada
+		calls string
+		want  string
+	}{
+		{"pocas peticiones", "fff", BreakerClosed},
+		{"tasa de errores", "offf", BreakerOpen},
+		{"justo en el umbral", "offo", BreakerOpen},
+		{"bajo el umbral", "oofoo", BreakerClosed},
+		{"llamadas lentas", "osss", BreakerOpen},
+		{"las ignoradas no cuentan", "iiifff", BreakerClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBreaker()
+			for _, c := range tt.calls {
+				ok, _ := b.Allow()
+				if !ok {
+					t.Fatal("rechazada antes de terminar la secuencia")
+				}
+				latency := time.Millisecond
+				if c == 's' {
+					latency = 2 * time.Second
+				}
+				b.done(c == 'f', c == 'i', latency)
+			}
+			if got := b.Status().State; got != tt.want {
+				t.Errorf("estado = %s, se esperaba %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	open := func(t *testing.T) *Breaker {
+		b := testBreaker()
+		for i := 0; i < 4; i++ {
+			attempt(b, true, 0)
+		}
+		ok, wait := b.Allow()
+		if ok || wait <= 0 || wait > 20*time.Millisecond {
+			t.Fatalf("abierto: Allow = %v, %v", ok, wait)
+		}
+		time.Sleep(25 * time.Millisecond)
+		return b
+	}
+
+	t.Run("pruebas exitosas cierran", func(t *testing.T) {
+		b := open(t)
+		a, _ := b.Allow()
+		c, _ := b.Allow()
+		if !a || !c {
+			t.Fatal("al vencer open_duration debían pasar half_open_requests pruebas")
+		}
+		if ok, _ := b.Allow(); ok {
+			t.Fatal("con las pruebas en curso no debía pasar otra")
+		}
+		b.done(false, false, time.Millisecond)
+		b.done(false, false, time.Millisecond)
+		if st := b.Status(); st.State != BreakerClosed || st.Requests != 0 {
+			t.Fatalf("Status = %+v, se esperaba cerrado y con la ventana vacía", st)
+		}
+		if st := b.Status(); st.Transitions[BreakerOpen] != 1 || st.Transitions[BreakerHalfOpen] != 1 || st.Transitions[BreakerClosed] != 1 {
+			t.Errorf("transiciones = %v", st.Transitions)
+		}
+	})
+
+	t.Run("una prueba fallida reabre", func(t *testing.T) {
+		b := open(t)
+		if !attempt(b, false, time.Millisecond) {
+			t.Fatal("la primera prueba debía pasar")
+		}
+		if !attempt(b, true, time.Millisecond) {
+			t.Fatal("la segunda prueba debía pasar")
+		}
+		if got := b.Status().State; got != BreakerOpen {
+			t.Errorf("estado = %s, se esperaba open", got)
+		}
+	})
+
+	t.Run("una prueba lenta reabre", func(t *testing.T) {
+		b := open(t)
+		attempt(b, false, 2*time.Second)
+		if got := b.Status().State; got != BreakerOpen {
+			t.Errorf("estado = %s, se esperaba open", got)
+		}
+	})
+
+	t.Run("una prueba ignorada libera su lugar", func(t *testing.T) {
+		b := open(t)
+		b.Allow()
+		b.Allow()
+		b.done(false, true, 0)
+		if ok, _ := b.Allow(); !ok {
+			t.Fatal("la prueba ignorada debía dejar lugar a otra")
+		}
+		if got := b.Status().State; got != BreakerHalfOpen {
+			t.Errorf("estado = %s, se esperaba half_open", got)
+		}
+	})
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := testBreaker()
+	for i := 0; i < 4; i++ {
+		attempt(b, true, 0)
+	}
+	cfg := b.cfg
+	cfg.Disabled = true
+	b.configure(cfg)
+	if st := b.Status(); st.State != BreakerClosed {
+		t.Fatalf("desactivar debía cerrar el breaker: %s", st.State)
+	}
+	for i := 0; i < 10; i++ {
+		if !attempt(b, true, 0) {
+			t.Fatal("desactivado no debía rechazar")
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"gateway/config"
+)
+
+// -------------------------
+// Límite de concurrencia
+// -------------------------
+// Cada ruta y el gateway entero admiten hasta un máximo de peticiones en curso
+// hacia los upstreams. Las que no entran esperan en una cola acotada; si la
+// cola está llena se descarta la de menor prioridad (la recién llegada si es
+// la de menor prioridad). Al liberarse lugar pasa primero la de mayor
+// prioridad y, entre iguales, la más antigua.
+
+// ErrShed indica que la petición se descartó por falta de lugar (cola llena,
+// desplazada por otra de mayor prioridad o vencido el tiempo de espera).
+var ErrShed = errors.New("proxy: límite de concurrencia alcanzado")
+
+// priorities ordena las clases de config.Priority*: más alto, más prioritario.
+var priorities = map[string]int{
+	config.PriorityLow:      0,
+	config.PriorityNormal:   1,
+	config.PriorityHigh:     2,
+	config.PriorityCritical: 3,
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{} // se cierra al admitirla o descartarla
+	err      error
+}
+
+// Limiter es un límite de concurrencia con cola. Como el circuit breaker,
+// sobrevive a los reloads: las peticiones en curso siguen contando.
+type Limiter struct {
+	name string
+
+	mu       sync.Mutex
+	cfg      config.RouteConcurrencyConfig
+	limit    float64 // vigente; con adaptive varía entre MinLimit y MaxInFlight
+	inFlight int
+	queue    []*waiter
+	seq      uint64
+	lastDrop time.Time
+
+	// Métricas
+	admitted uint64
+	shed     uint64
+	timeouts uint64
+}
+
+func newLimiter(name string, cfg config.RouteConcurrencyConfig) *Limiter {
+	l := &Limiter{name: name}
+	l.configure(cfg)
+	return l
+}
+
+// configure aplica la config; el límite adaptativo conserva su valor si sigue
+// dentro del rango nuevo.
+func (l *Limiter) configure(cfg config.RouteConcurrencyConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	ceiling := float64(cfg.MaxInFlight)
+	switch {
+	case !cfg.Adaptive.Enabled || l.limit == 0 || l.limit > ceiling:
+		l.limit = ceiling
+	case l.limit < float64(cfg.Adaptive.MinLimit):
+		l.limit = float64(cfg.Adaptive.MinLimit)
+	}
+	// Con más lugar o cola más chica
+	l.drain()
+	for len(l.queue) > cfg.QueueSize {
+		l.reject(l.lowest())
+	}
+}
+
+// Acquire espera lugar para una petición de la prioridad indicada. Si la
+// admite, hay que llamar a release al terminar con la latencia observada y
+// si falló (alimentan el límite adaptativo); latencia 0 = no llegó al upstream.
+func (l *Limiter) Acquire(ctx context.Context, priority string) (release func(latency time.Duration, failed bool), err error) {
+	l.mu.Lock()
+	if l.cfg.MaxInFlight == 0 {
+		l.mu.Unlock()
+		return func(time.Duration, bool) {}, nil
+	}
+	if l.inFlight < int(l.limit) && len(l.queue) == 0 {
+		l.inFlight++
+		l.admitted++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+
+	w := &waiter{priority: priorities[priority], ready: make(chan struct{})}
+	if len(l.queue) >= l.cfg.QueueSize {
+		victim := l.lowest()
+		if victim == nil || victim.priority >= w.priority {
+			l.shed++
+			l.mu.Unlock()
+			return nil, ErrShed
+		}
+		l.reject(victim)
+	}
+	l.seq++
+	w.seq = l.seq
+	l.queue = append(l.queue, w)
+	timeout := l.cfg.QueueTimeout
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Admitida o descartada, aunque haya vencido la espera a la vez
+		if w.err != nil {
+			return nil, w.err
+		}
+		return l.release, nil
+	default:
+	}
+	l.remove(w)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	l.timeouts++
+	return nil, ErrShed
+}
+
+func (l *Limiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if a := l.cfg.Adaptive; a.Enabled {
+		now := time.Now()
+		switch {
+		case latency == 0:
+		case failed || latency > a.Latency:
+			// Una sola baja por intervalo: las respuestas lentas llegan en tanda
+			if now.Sub(l.lastDrop) >= a.Latency {
+				l.limit = max(float64(a.MinLimit), l.limit*a.Backoff)
+				l.lastDrop = now
+			}
+		case l.inFlight+1 >= int(l.limit)/2:
+			// Sube ~1 por cada "ronda" de peticiones, y solo si se está usando
+			l.limit = min(float64(l.cfg.MaxInFlight), l.limit+1/l.limit)
+		}
+	}
+	l.drain()
+}
+
+// drain admite de la cola mientras haya lugar. Requiere l.mu.
+func (l *Limiter) drain() {
+	for len(l.queue) > 0 && (l.cfg.MaxInFlight == 0 || l.inFlight < int(l.limit)) {
+		w := l.highest()
+		l.remove(w)
+		l.inFlight++
+		l.admitted++
+		close(w.ready)
+	}
+}
+
+// reject descarta w de la cola. Requiere l.mu.
+func (l *Limiter) reject(w *waiter) {
+	l.remove(w)
+	l.shed++
+	w.err = ErrShed
+	close(w.ready)
+}
+
+// highest es la de mayor prioridad y, entre iguales, la más antigua.
+func (l *Limiter) highest() *waiter {
+	var best *waiter
+	for _, w := range l.queue {
+		if best == nil || w.priority > best.priority || (w.priority == best.priority && w.seq < best.seq) {
+			best = w
+		}
+	}
+	return best
+}
+
+// lowest es la de menor prioridad y, entre iguales, la más nueva.
+func (l *Limiter) lowest() *waiter {
+	var worst *waiter
+	for _, w := range l.queue {
+		if worst == nil || w.priority < worst.priority || (w.priority == worst.priority && w.seq > worst.seq) {
+			worst = w
+		}
+	}
+	return worst
+}
+
+func (l *Limiter) remove(w *waiter) {
+	for i, q := range l.queue {
+		if q == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// LimiterStatus es el estado de un límite de concurrencia.
+type LimiterStatus struct {
+	Name     string `json:"name"`
+	Limit    int    `json:"limit"` // 0 = sin límite
+	InFlight int    `json:"in_flight"`
+	Queued   int    `json:"queued"`
+	Admitted uint64 `json:"admitted"`
+	Shed     uint64 `json:"shed"`
+	Timeouts uint64 `json:"timeouts"`
+}
+
+func (l *Limiter) Status() LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStatus{
+		Name:     l.name,
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Queued:   len(l.queue),
+		Admitted: l.admitted,
+		Shed:     l.shed,
+		Timeouts: l.timeouts,
+	}
+}
+
+// -------------------------
+// Límite global y prioridades
+// -------------------------
+
+var (
+	globalLimiter = newLimiter("global", config.RouteConcurrencyConfig{})
+
+	priorityMu    sync.RWMutex
+	priorityRules []config.PriorityRule
+)
+
+// ConfigureConcurrency aplica el límite global y las reglas de prioridad (se
+// llama en cada reload).
+func ConfigureConcurrency(cfg config.ConcurrencyConfig) {
+	globalLimiter.configure(config.RouteConcurrencyConfig{
+		MaxInFlight:  cfg.MaxInFlight,
+		QueueSize:    cfg.QueueSize,
+		QueueTimeout: cfg.QueueTimeout,
+	})
+	priorityMu.Lock()
+	priorityRules = cfg.Priorities
+	priorityMu.Unlock()
+}
+
+// GlobalConcurrency devuelve el estado del límite global.
+func GlobalConcurrency() LimiterStatus {
+	return globalLimiter.Status()
+}
+
+// PriorityOf devuelve la clase de prioridad de req (según el path original).
+func PriorityOf(req *http.Request) string {
+	priorityMu.RLock()
+	defer priorityMu.RUnlock()
+	for _, rule := range priorityRules {
+		if !config.MatchMethod(rule.Methods, req.Method) {
+			continue
+		}
+		for _, p := range rule.Paths {
+			if config.MatchPath(p, req.URL.Path) {
+				return rule.Priority
+			}
+		}
+	}
+	return config.PriorityNormal
+}
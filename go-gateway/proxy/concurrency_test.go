@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+// acquired es el resultado de un Acquire que quedó esperando en la cola.
+type acquired struct {
+	priority string
+	release  func(time.Duration, bool)
+	err      error
+}
+
+// enqueue lanza un Acquire que debe quedar en cola y espera a que esté en ella.
+func enqueue(t *testing.T, l *Limiter, ctx context.Context, priority string, done chan<- acquired) {
+	t.Helper()
+	queued := l.Status().Queued
+	go func() {
+		release, err := l.Acquire(ctx, priority)
+		done <- acquired{priority, release, err}
+	}()
+	for deadline := time.Now().Add(time.Second); l.Status().Queued == queued; {
+		if time.Now().After(deadline) {
+			t.Fatalf("la petición %s no llegó a la cola", priority)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterAdmitsByPriority(t *testing.T) {
+	l := newLimiter("r", config.RouteConcurrencyConfig{MaxInFlight: 1, QueueSize: 4, QueueTimeout: time.Minute})
+	release, err := l.Acquire(context.Background(), config.PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan acquired, 4)
+	for _, p := range []string{config.PriorityLow, config.PriorityNormal, config.PriorityCritical, config.PriorityNormal} {
+		enqueue(t, l, context.Background(), p, done)
+	}
+
+	// Cada una que termina deja pasar a la siguiente: la de mayor prioridad y,
+	// entre iguales, la más antigua
+	var order []string
+	for i := 0; i < 4; i++ {
+		release(0, false)
+		a := <-done
+		if a.err != nil {
+			t.Fatalf("%s: %v", a.priority, a.err)
+		}
+		order = append(order, a.priority)
+		release = a.release
+	}
+	release(0, false)
+	want := []string{config.PriorityCritical, config.PriorityNormal, config.PriorityNormal, config.PriorityLow}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("orden = %v, se esperaba %v", order, want)
+		}
+	}
+	if st := l.Status(); st.InFlight != 0 || st.Admitted != 5 {
+		t.Errorf("Status = %+v", st)
+	}
+}
+
+func TestLimiterShedsLowestPriority(t *testing.T) {
+	l := newLimiter("r", config.RouteConcurrencyConfig{MaxInFlight: 1, QueueSize: 1, QueueTimeout: time.Minute})
+	release, _ := l.Acquire(context.Background(), config.PriorityNormal)
+	defer release(0, false)
+
+	low := make(chan acquired, 1)
+	enqueue(t, l, context.Background(), config.PriorityLow, low)
+
+	// Con la cola llena, una de mayor prioridad desplaza a la de menor...
+	go l.Acquire(context.Background(), config.PriorityHigh)
+	if a := <-low; !errors.Is(a.err, ErrShed) {
+		t.Fatalf("la de prioridad baja debía descartarse: %v", a.err)
+	}
+
+	// ...y una que no es mayor que todas las de la cola se descarta enseguida
+	for _, p := range []string{config.PriorityHigh, config.PriorityNormal} {
+		if _, err := l.Acquire(context.Background(), p); !errors.Is(err, ErrShed) {
+			t.Errorf("%s con la cola llena: %v, se esperaba ErrShed", p, err)
+		}
+	}
+	if st := l.Status(); st.Shed != 3 || st.Queued != 1 {
+		t.Errorf("Status = %+v", st)
+	}
+}
+
+func TestLimiterQueueTimeoutAndCancel(t *testing.T) {
+	l := newLimiter("r", config.RouteConcurrencyConfig{MaxInFlight: 1, QueueSize: 2, QueueTimeout: 20 * time.Millisecond})
+	release, _ := l.Acquire(context.Background(), config.PriorityNormal)
+	defer release(0, false)
+
+	if _, err := l.Acquire(context.Background(), config.PriorityNormal); !errors.Is(err, ErrShed) {
+		t.Fatalf("al vencer queue_timeout: %v, se esperaba ErrShed", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan acquired, 1)
+	enqueue(t, l, ctx, config.PriorityNormal, done)
+	cancel()
+	if a := <-done; !errors.Is(a.err, context.Canceled) {
+		t.Fatalf("al cancelar el cliente: %v", a.err)
+	}
+	if st := l.Status(); st.Timeouts != 1 || st.Queued != 0 {
+		t.Errorf("Status = %+v", st)
+	}
+}
+
+func TestLimiterShrinkingQueueOnReload(t *testing.T) {
+	cfg := config.RouteConcurrencyConfig{MaxInFlight: 1, QueueSize: 2, QueueTimeout: time.Minute}
+	l := newLimiter("r", cfg)
+	release, _ := l.Acquire(context.Background(), config.PriorityNormal)
+
+	done := make(chan acquired, 2)
+	enqueue(t, l, context.Background(), config.PriorityHigh, done)
+	enqueue(t, l, context.Background(), config.PriorityLow, done)
+
+	cfg.QueueSize = 1
+	l.configure(cfg)
+	if a := <-done; a.priority != config.PriorityLow || !errors.Is(a.err, ErrShed) {
+		t.Fatalf("al achicar la cola debía salir la de menor prioridad: %+v", a)
+	}
+
+	// Con más lugar pasa la que quedó, sin esperar a que termine la primera
+	cfg.MaxInFlight = 2
+	l.configure(cfg)
+	if a := <-done; a.priority != config.PriorityHigh || a.err != nil {
+		t.Fatalf("con más lugar debía admitirse la que esperaba: %+v", a)
+	}
+	release(0, false)
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	const latency = 20 * time.Millisecond
+	l := newLimiter("r", config.RouteConcurrencyConfig{
+		MaxInFlight: 8,
+		Adaptive:    config.AdaptiveConfig{Enabled: true, MinLimit: 2, Latency: latency, Backoff: 0.5},
+	})
+	limit := func() int { return l.Status().Limit }
+	// one hace una petición que tarda d (y falla si failed)
+	one := func(d time.Duration, failed bool) {
+		release, err := l.Acquire(context.Background(), config.PriorityNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(d, failed)
+	}
+
+	if limit() != 8 {
+		t.Fatalf("límite inicial %d, se esperaba max_in_flight", limit())
+	}
+	// Sin usar la mitad del límite no sube (ni baja)
+	one(time.Millisecond, false)
+	if limit() != 8 {
+		t.Fatalf("límite %d tras una respuesta rápida", limit())
+	}
+
+	// Una respuesta lenta baja a la mitad; las de la misma tanda no
+	one(2*latency, false)
+	one(2*latency, false)
+	if limit() != 4 {
+		t.Fatalf("límite %d tras una tanda lenta, se esperaba 4", limit())
+	}
+	// Las que no llegaron al upstream no cuentan
+	one(0, true)
+	if limit() != 4 {
+		t.Fatalf("límite %d tras una petición que no llegó al upstream", limit())
+	}
+	// Un fallo cuenta como lenta; nunca baja de min_limit
+	time.Sleep(latency)
+	one(time.Millisecond, true)
+	time.Sleep(latency)
+	one(2*latency, false)
+	if limit() != 2 {
+		t.Fatalf("límite %d, se esperaba min_limit", limit())
+	}
+
+	// Usándolo (la mitad del límite en curso), sube de a poco hasta
+	// max_in_flight y no más
+	busy := func() {
+		var held []func(time.Duration, bool)
+		for i := 1; i < limit()/2; i++ {
+			release, _ := l.Acquire(context.Background(), config.PriorityNormal)
+			held = append(held, release)
+		}
+		one(time.Millisecond, false)
+		for _, release := range held {
+			release(0, false)
+		}
+	}
+	steps := 0
+	for limit() < 8 {
+		busy()
+		if steps++; steps > 100 {
+			t.Fatalf("el límite quedó en %d", limit())
+		}
+	}
+	if steps < 8 {
+		t.Errorf("subió de 2 a 8 en %d respuestas: debía ser de a poco", steps)
+	}
+	for i := 0; i < 20; i++ {
+		busy()
+	}
+	if limit() != 8 {
+		t.Errorf("límite %d, no debía pasar de max_in_flight", limit())
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	ConfigureConcurrency(config.ConcurrencyConfig{Priorities: []config.PriorityRule{
+		{Priority: config.PriorityCritical, Paths: []string{"/api/actuadores/*"}, Methods: []string{http.MethodPost}},
+		{Priority: config.PriorityLow, Paths: []string{"/api/reportes/*"}},
+	}})
+	t.Cleanup(func() { ConfigureConcurrency(config.ConcurrencyConfig{}) })
+
+	tests := []struct {
+		method, target, want string
+	}{
+		{http.MethodPost, "/api/actuadores/5/activar", config.PriorityCritical},
+		{http.MethodGet, "/api/actuadores/5", config.PriorityNormal},
+		{http.MethodGet, "/api/reportes/mensual", config.PriorityLow},
+		{http.MethodGet, "/api/sensores", config.PriorityNormal},
+	}
+	for _, tt := range tests {
+		if got := PriorityOf(httptest.NewRequest(tt.method, tt.target, nil)); got != tt.want {
+			t.Errorf("%s %s: %s, se esperaba %s", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gateway/config"
+)
+
+// TimeoutHeader lleva el tiempo que le queda a la petición. El cliente puede
+// mandarlo para acortar el timeout de la ruta (nunca alargarlo) y el gateway
+// se lo pasa al upstream con lo que resta, en milisegundos.
+// Acepta milisegundos ("1500") o una duración de Go ("1.5s").
+const TimeoutHeader = "X-Request-Timeout"
+
+// clientTimeout lee TimeoutHeader; ok es false si no vino o no es válido.
+func clientTimeout(req *http.Request) (time.Duration, bool) {
+	v := req.Header.Get(TimeoutHeader)
+	if v == "" {
+		return 0, false
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, ms > 0
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d > 0
+}
+
+// propagateDeadline reescribe TimeoutHeader con lo que le queda al contexto.
+// Se llama antes de cada intento, así un reintento avisa del tiempo restante.
+func propagateDeadline(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		req.Header.Del(TimeoutHeader)
+		return
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	req.Header.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+}
+
+// isTimeout indica si err es un vencimiento: deadline de la petición, de
+// conexión o de espera de headers.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// newTransport crea el transporte de una ruta con sus timeouts de conexión y
+// de headers; el timeout total lo pone el contexto en Route.ServeHTTP.
+func newTransport(rc config.RouteConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   rc.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = rc.ConnectTimeout
+	t.ResponseHeaderTimeout = rc.ResponseHeaderTimeout
+	return t
+}
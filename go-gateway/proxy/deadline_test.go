@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func TestClientTimeout(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"1500", 1500 * time.Millisecond, true},
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"-1s", 0, false},
+		{"pronto", 0, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set(TimeoutHeader, tt.header)
+		}
+		d, ok := clientTimeout(req)
+		if ok != tt.ok || (ok && d != tt.want) {
+			t.Errorf("%s: %q = %v, %v; se esperaba %v, %v", TimeoutHeader, tt.header, d, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// deadlineTable arma una ruta con timeout hacia un upstream que responde tras
+// delay y anota el TimeoutHeader que recibió.
+func deadlineTable(t *testing.T, timeout, delay time.Duration, got *string) *Table {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got = r.Header.Get(TimeoutHeader)
+		time.Sleep(delay)
+	}))
+	t.Cleanup(srv.Close)
+
+	// El breaker no llega a abrir: solo cuenta los fallos
+	breaker := config.CircuitBreakerConfig{Window: time.Minute, MinRequests: 100, ErrorRate: 1, SlowCallDuration: time.Minute, SlowCallRate: 1}
+	table, err := NewTable(map[string]config.UpstreamConfig{"a": {URL: srv.URL, CircuitBreaker: breaker}},
+		[]config.RouteConfig{{Name: "api", Prefix: "/api", Upstream: "a", Timeout: timeout}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Commit()
+	return table
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		header  string
+		// el upstream debe recibir entre min y max milisegundos
+		min, max int64
+	}{
+		{"timeout de la ruta", time.Second, "", 900, 1000},
+		{"el cliente lo acorta", time.Second, "200", 100, 200},
+		{"el cliente no lo alarga", time.Second, "5s", 900, 1000},
+		{"sin timeout de la ruta vale el del cliente", 0, "300ms", 200, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			table := deadlineTable(t, tt.timeout, 0, &got)
+			req := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+			if tt.header != "" {
+				req.Header.Set(TimeoutHeader, tt.header)
+			}
+			table.Match("/api/x").ServeHTTP(httptest.NewRecorder(), req)
+
+			ms, err := strconv.ParseInt(got, 10, 64)
+			if err != nil || ms < tt.min || ms > tt.max {
+				t.Errorf("el upstream recibió %s %q, se esperaba entre %d y %d", TimeoutHeader, got, tt.min, tt.max)
+			}
+		})
+	}
+
+	t.Run("sin plazo no se reenvía", func(t *testing.T) {
+		got := "sin llamar"
+		table := deadlineTable(t, 0, 0, &got)
+		req := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+		req.Header.Set(TimeoutHeader, "pronto")
+		table.Match("/api/x").ServeHTTP(httptest.NewRecorder(), req)
+		if got != "" {
+			t.Errorf("el upstream recibió %s %q", TimeoutHeader, got)
+		}
+	})
+}
+
+func TestDeadlineExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		header  string
+		// si el vencimiento cuenta como fallo de la instancia
+		failure bool
+	}{
+		{"vence el timeout de la ruta", 20 * time.Millisecond, "", true},
+		{"vence el plazo del cliente", time.Second, "20", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			table := deadlineTable(t, tt.timeout, 200*time.Millisecond, &got)
+			route := table.Match("/api/x")
+			req := httptest.NewRequest(http.MethodGet, "/api/x", nil)
+			if tt.header != "" {
+				req.Header.Set(TimeoutHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			route.ServeHTTP(w, req)
+
+			if w.Code != http.StatusGatewayTimeout {
+				t.Fatalf("status = %d, se esperaba 504", w.Code)
+			}
+			st := route.Pool.Breaker.Status()
+			if failure := st.Failures == 1; failure != tt.failure {
+				t.Errorf("fallos en el breaker = %d, se esperaba que contara: %v", st.Failures, tt.failure)
+			}
+		})
+	}
+}
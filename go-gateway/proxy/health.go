@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// targetState es el estado vivo de una instancia: conexiones en curso y salud.
+type targetState struct {
+	active atomic.Int64 // peticiones en curso
+
+	mu           sync.Mutex
+	healthy      bool // resultado del chequeo activo
+	checked      bool // ya pasó al menos un chequeo OK
+	successes    int  // chequeos OK seguidos
+	failures     int  // chequeos fallidos seguidos
+	lastCheck    time.Time
+	lastError    string
+	passiveFails int // 5xx / errores de conexión seguidos
+	ejectedUntil time.Time
+}
+
+func newTargetState(healthy bool) *targetState {
+	return &targetState{healthy: healthy}
+}
+
+// withoutActiveCheck marca sana una instancia cuyo upstream dejó de tener
+// chequeo activo tras un reload; si no, quedaría fuera para siempre.
+func (s *targetState) withoutActiveCheck() {
+	s.mu.Lock()
+	s.healthy = true
+	s.mu.Unlock()
+}
+
+// Available indica si el target puede recibir tráfico: sano según el chequeo
+// activo y no expulsado por el pasivo.
+func (t *Target) Available() bool {
+	s := t.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy && !time.Now().Before(s.ejectedUntil)
+}
+
+// TargetStatus es la foto del estado de una instancia (página de estado).
+type TargetStatus struct {
+	URL          string    `json:"url"`
+	Weight       int       `json:"weight"`
+	Available    bool      `json:"available"`
+	Healthy      bool      `json:"healthy"`
+	Active       int64     `json:"active"`
+	LastCheck    time.Time `json:"last_check,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	EjectedUntil time.Time `json:"ejected_until,omitempty"`
+}
+
+// Status devuelve el estado actual del target.
+func (t *Target) Status() TargetStatus {
+	s := t.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := TargetStatus{
+		URL:       t.URL.String(),
+		Weight:    t.Weight,
+		Healthy:   s.healthy,
+		Available: s.healthy && !time.Now().Before(s.ejectedUntil),
+		Active:    s.active.Load(),
+		LastCheck: s.lastCheck,
+		LastError: s.lastError,
+	}
+	if time.Now().Before(s.ejectedUntil) {
+		st.EjectedUntil = s.ejectedUntil
+	}
+	return st
+}
+
+// -------------------------
+// Chequeo pasivo
+// -------------------------
+
+// observe registra el resultado de una petición real. Tras
+// Passive.ConsecutiveFailures fallos seguidos expulsa la instancia durante
+// Passive.EjectionTime; al vencer vuelve a recibir tráfico sin más.
+func (p *Pool) observe(t *Target, failed bool, reason string) {
+	s := t.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !failed {
+		s.passiveFails = 0
+		return
+	}
+	s.passiveFails++
+	s.lastError = reason
+	if s.passiveFails >= p.cfg.Passive.ConsecutiveFailures {
+		s.passiveFails = 0
+		s.ejectedUntil = time.Now().Add(p.cfg.Passive.EjectionTime)
+		slog.Warn("upstream: target expulsado", "upstream", p.Name, "target", t.URL.Redacted(), "duration", p.cfg.Passive.EjectionTime.String(), "reason", reason)
+	}
+}
+
+// -------------------------
+// Chequeo activo
+// -------------------------
+
+// StartHealthChecks lanza un GET periódico a health_check.path en cada
+// instancia hasta que se llame a StopHealthChecks. El primero sale enseguida.
+func (p *Pool) StartHealthChecks() {
+	hc := p.cfg.HealthCheck
+	if hc.Path == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+	client := &http.Client{Timeout: hc.Timeout}
+	for _, t := range p.Targets {
+		go func(t *Target) {
+			ticker := time.NewTicker(hc.Interval)
+			defer ticker.Stop()
+			for {
+				p.check(ctx, client, t)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(t)
+	}
+}
+
+// StopHealthChecks detiene los chequeos activos del pool.
+func (p *Pool) StopHealthChecks() {
+	if p.stop != nil {
+		p.stop()
+	}
+}
+
+func (p *Pool) check(ctx context.Context, client *http.Client, t *Target) {
+	hc := p.cfg.HealthCheck
+	err := probe(ctx, client, strings.TrimSuffix(t.URL.String(), "/")+hc.Path)
+	if ctx.Err() != nil {
+		return
+	}
+
+	s := t.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCheck = time.Now()
+	if err == nil {
+		s.successes++
+		s.failures = 0
+		s.lastError = ""
+		// Una instancia recién arrancada entra con el primer OK; una que cayó
+		// necesita healthy_threshold seguidos
+		if !s.healthy && (!s.checked || s.successes >= hc.HealthyThreshold) {
+			s.healthy = true
+			slog.Info("upstream: target sano", "upstream", p.Name, "target", t.URL.Redacted())
+		}
+		s.checked = true
+		return
+	}
+	s.failures++
+	s.successes = 0
+	s.lastError = err.Error()
+	if s.healthy && s.failures >= hc.UnhealthyThreshold {
+		s.healthy = false
+		slog.Warn("upstream: target no sano", "upstream", p.Name, "target", t.URL.Redacted(), "error", err)
+	}
+}
+
+func probe(ctx context.Context, client *http.Client, u string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PoolStatus es el estado de un upstream y sus instancias.
+type PoolStatus struct {
+	Name      string         `json:"name"`
+	Strategy  string         `json:"strategy"`
+	Available int            `json:"available"`
+	Breaker   BreakerStatus  `json:"circuit_breaker"`
+	Targets   []TargetStatus `json:"targets"`
+}
+
+// Status devuelve el estado del pool.
+func (p *Pool) Status() PoolStatus {
+	st := PoolStatus{Name: p.Name, Strategy: p.Strategy, Breaker: p.Breaker.Status(), Targets: []TargetStatus{}}
+	for _, t := range p.Targets {
+		ts := t.Status()
+		if ts.Available {
+			st.Available++
+		}
+		st.Targets = append(st.Targets, ts)
+	}
+	return st
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func TestActiveHealthCheckThresholds(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("chequeo a %q", r.URL.Path)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer backend.Close()
+
+	p, err := NewPool("a", config.UpstreamConfig{
+		URL:         backend.URL + "/",
+		HealthCheck: config.HealthCheckConfig{Path: "/health", HealthyThreshold: 2, UnhealthyThreshold: 2},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := p.Targets[0]
+	client := &http.Client{Timeout: time.Second}
+
+	// Cada paso es el status del chequeo y la disponibilidad que deja
+	steps := []struct {
+		status    int
+		available bool
+	}{
+		{http.StatusServiceUnavailable, false}, // sin OK todavía no recibe tráfico
+		{http.StatusOK, true},                  // recién arrancada: entra con el primer OK
+		{http.StatusServiceUnavailable, true},  // un fallo no alcanza
+		{http.StatusOK, true},                  // y un OK reinicia la cuenta
+		{http.StatusServiceUnavailable, true},
+		{http.StatusInternalServerError, false}, // dos seguidos: fuera
+		{http.StatusOK, false},                  // para volver necesita dos OK seguidos
+		{http.StatusOK, true},
+	}
+	for i, s := range steps {
+		status.Store(int32(s.status))
+		p.check(context.Background(), client, target)
+		if got := target.Available(); got != s.available {
+			t.Fatalf("paso %d (%d): Available = %v, se esperaba %v", i, s.status, got, s.available)
+		}
+	}
+}
+
+func TestPassiveEjection(t *testing.T) {
+	p, err := NewPool("a", config.UpstreamConfig{
+		URL:     "http://127.0.0.1:1",
+		Passive: config.PassiveHealthConfig{ConsecutiveFailures: 3, EjectionTime: 50 * time.Millisecond},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := p.Targets[0]
+
+	// Un éxito en el medio reinicia la cuenta
+	for _, failed := range []bool{true, true, false, true, true} {
+		p.observe(target, failed, "status 502")
+	}
+	if !target.Available() {
+		t.Fatal("expulsada sin llegar a 3 fallos seguidos")
+	}
+	p.observe(target, true, "status 502")
+	if target.Available() {
+		t.Fatal("con 3 fallos seguidos debía expulsarse")
+	}
+	if st := target.Status(); st.EjectedUntil.IsZero() || st.LastError != "status 502" {
+		t.Errorf("Status = %+v", st)
+	}
+
+	// Al vencer la expulsión vuelve sola
+	time.Sleep(60 * time.Millisecond)
+	if !target.Available() {
+		t.Error("al vencer ejection_time debía volver a recibir tráfico")
+	}
+}
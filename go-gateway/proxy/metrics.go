@@ -0,0 +1,19 @@
+package proxy
+
+import "gateway/metrics"
+
+// Tipos de fallo de gateway_upstream_errors_total.
+const (
+	errorStatus     = "status_5xx"
+	errorTimeout    = "timeout"
+	errorConnection = "connection"
+)
+
+var (
+	upstreamDuration = metrics.NewHistogramVec("gateway_upstream_request_duration_seconds",
+		"Latencia de cada intento contra un upstream, hasta recibir los headers de la respuesta.", nil, "upstream")
+	upstreamErrors = metrics.NewCounterVec("gateway_upstream_errors_total",
+		"Intentos fallidos contra un upstream: status_5xx, timeout o connection.", "upstream", "kind")
+	upstreamRetries = metrics.NewCounterVec("gateway_upstream_retries_total",
+		"Reintentos, por ruta.", "route")
+)
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"gateway/config"
+	"gateway/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// -------------------------
+// Presupuesto global de reintentos
+// -------------------------
+// Ventana de 10s en buckets de 1s con peticiones y reintentos. Se permite un
+// reintento si los de la ventana no superan max(MinPerSecond*10, Ratio*peticiones).
+
+const budgetWindow = 10
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+type retryBudget struct {
+	mu      sync.Mutex
+	cfg     config.RetryBudgetConfig
+	buckets [budgetWindow]budgetBucket
+	denied  uint64
+}
+
+var budget = &retryBudget{cfg: config.RetryBudgetConfig{Ratio: 0.2, MinPerSecond: 5}}
+
+// ConfigureRetryBudget aplica el presupuesto de reintentos (se llama en cada reload).
+func ConfigureRetryBudget(cfg config.RetryBudgetConfig) {
+	budget.mu.Lock()
+	budget.cfg = cfg
+	budget.mu.Unlock()
+}
+
+func (b *retryBudget) bucket(now time.Time) *budgetBucket {
+	sec := now.Unix()
+	bk := &b.buckets[sec%budgetWindow]
+	if bk.second != sec {
+		*bk = budgetBucket{second: sec}
+	}
+	return bk
+}
+
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	b.bucket(time.Now()).requests++
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	var requests, retries int
+	for _, bk := range b.buckets {
+		if now.Unix()-bk.second < budgetWindow {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	allowed := float64(b.cfg.MinPerSecond * budgetWindow)
+	if r := b.cfg.Ratio * float64(requests); r > allowed {
+		allowed = r
+	}
+	if float64(retries) >= allowed {
+		b.denied++
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// -------------------------
+// Transporte con reintentos
+// -------------------------
+
+// retryTransport reintenta en otra instancia del pool (si la hay) los errores
+// de conexión y las respuestas de retry.on_status.
+type retryTransport struct {
+	route *Route
+	base  http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	budget.request()
+	propagateDeadline(req)
+	rc := t.route.Config.Retry
+	if rc.Attempts <= 1 || !retryable(req) {
+		return t.send(req, 1)
+	}
+	if !bufferBody(req, rc.MaxBodyBytes) {
+		return t.send(req, 1)
+	}
+
+	cl := callFrom(req)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			propagateDeadline(req)
+		}
+		resp, err := t.send(req, attempt)
+
+		reason := ""
+		switch {
+		case err != nil:
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return nil, err
+			}
+			reason = err.Error()
+		case retryStatus(rc, resp.StatusCode):
+			reason = resp.Status
+		default:
+			return resp, nil
+		}
+
+		if attempt >= rc.Attempts || !budget.withdraw() {
+			return resp, err
+		}
+		// El intento fallido cuenta para el chequeo pasivo de su instancia
+		t.route.Pool.observe(cl.target, true, reason)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), backoff(rc, attempt)); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		t.route.retarget(req, cl)
+		upstreamRetries.Inc(t.route.Config.Name)
+		slog.WarnContext(req.Context(), "proxy: reintento", "route", t.route.Config.Name, "attempt", attempt+1, "max_attempts", rc.Attempts, "target", cl.target.URL.Redacted(), "reason", reason)
+	}
+}
+
+var tracer = otel.Tracer("gateway/proxy")
+
+// send hace un intento contra el upstream dentro de un span de cliente (con
+// traceparent hacia el upstream) y lo registra en las métricas. Lo que cancela
+// el cliente no cuenta como fallo del upstream.
+func (t *retryTransport) send(req *http.Request, attempt int) (*http.Response, error) {
+	name := t.route.Pool.Name
+	ctx, span := tracer.Start(req.Context(), req.Method+" "+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLFull(req.URL.Redacted()),
+		semconv.ServerAddress(req.URL.Hostname()),
+		semconv.PeerService(name),
+		attribute.String("gateway.route", t.route.Config.Name),
+	))
+	if attempt > 1 {
+		span.SetAttributes(semconv.HTTPRequestResendCount(attempt - 1))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	tracing.End(span, err)
+	if errors.Is(err, context.Canceled) {
+		return resp, err
+	}
+
+	upstreamDuration.Observe(time.Since(start).Seconds(), name)
+	switch {
+	case err != nil && isTimeout(err):
+		upstreamErrors.Inc(name, errorTimeout)
+	case err != nil:
+		upstreamErrors.Inc(name, errorConnection)
+	case resp.StatusCode >= 500:
+		upstreamErrors.Inc(name, errorStatus)
+	}
+	return resp, err
+}
+
+// retarget elige otra instancia para el reintento, si el pool tiene alguna.
+func (r *Route) retarget(req *http.Request, cl *call) {
+	next := cl.target
+	for i := 0; i < len(r.Pool.Targets); i++ {
+		if t := r.Pool.Pick(req); t != nil && t != cl.target {
+			next = t
+			break
+		}
+	}
+	if next != cl.target {
+		cl.target.state.active.Add(-1)
+		next.state.active.Add(1)
+		cl.target = next
+	}
+	r.pointTo(req, cl)
+}
+
+// retryable indica si reenviar la petición es seguro: métodos idempotentes
+// (RFC 9110) o una petición con Idempotency-Key.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func retryStatus(rc config.RetryConfig, code int) bool {
+	for _, c := range rc.OnStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferBody guarda el cuerpo en memoria para poder reenviarlo. Si supera
+// max devuelve false y deja el cuerpo intacto para un único intento.
+func bufferBody(req *http.Request, max int64) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.ContentLength > max {
+		return false
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil || int64(len(buf)) > max {
+		// Se recompone lo leído delante de lo que falta
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return false
+	}
+	req.Body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return true
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// backoff es exponencial con jitter completo.
+func backoff(rc config.RetryConfig, attempt int) time.Duration {
+	d := rc.Backoff << (attempt - 1)
+	if d > rc.MaxBackoff || d <= 0 {
+		d = rc.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		method, key string
+		want        bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodHead, "", true},
+		{http.MethodOptions, "", true},
+		{http.MethodPut, "", true},
+		{http.MethodDelete, "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPatch, "", false},
+		{http.MethodPost, "k-1", true},
+		{http.MethodPatch, "k-1", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		if tt.key != "" {
+			req.Header.Set("Idempotency-Key", tt.key)
+		}
+		if got := retryable(req); got != tt.want {
+			t.Errorf("%s (Idempotency-Key %q): retryable = %v, se esperaba %v", tt.method, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := &retryBudget{cfg: config.RetryBudgetConfig{Ratio: 0.5, MinPerSecond: 1}}
+
+	// Sin tráfico vale el mínimo: 1 por segundo en la ventana de 10s
+	for i := 0; i < 10; i++ {
+		if !b.withdraw() {
+			t.Fatalf("reintento %d rechazado dentro del mínimo", i+1)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("el reintento 11 superaba el mínimo")
+	}
+
+	// Con 40 peticiones en la ventana el 50% da lugar a 20
+	for i := 0; i < 40; i++ {
+		b.request()
+	}
+	for i := 0; i < 10; i++ {
+		if !b.withdraw() {
+			t.Fatalf("reintento %d rechazado dentro de ratio", 11+i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("el reintento 21 superaba ratio")
+	}
+	if b.denied != 2 {
+		t.Errorf("denied = %d, se esperaba 2", b.denied)
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hola"))
+	if !bufferBody(req, 4) {
+		t.Fatal("un cuerpo de max bytes debía guardarse")
+	}
+	for i := 0; i < 2; i++ {
+		body, _ := req.GetBody()
+		if b, _ := io.ReadAll(body); string(b) != "hola" {
+			t.Fatalf("GetBody = %q", b)
+		}
+	}
+
+	// Si no entra queda intacto para un solo intento, aunque no diga su largo
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hola mundo"))
+	req.ContentLength = -1
+	if bufferBody(req, 4) {
+		t.Fatal("un cuerpo de más de max bytes no debía guardarse")
+	}
+	if b, _ := io.ReadAll(req.Body); string(b) != "hola mundo" {
+		t.Errorf("cuerpo = %q, se esperaba intacto", b)
+	}
+}
+
+// flakyBackend responde 503 a las primeras fails peticiones y anota los
+// cuerpos que recibe.
+type flakyBackend struct {
+	mu     sync.Mutex
+	fails  int
+	bodies []string
+}
+
+func (f *flakyBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bodies = append(f.bodies, string(b))
+	if len(f.bodies) <= f.fails {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func TestRetriesOnlyIdempotentRequests(t *testing.T) {
+	prev := budget
+	budget = &retryBudget{cfg: config.RetryBudgetConfig{Ratio: 0.2, MinPerSecond: 5}}
+	t.Cleanup(func() { budget = prev })
+
+	tests := []struct {
+		name, method, key string
+		fails             int
+		want              int
+		attempts          int
+	}{
+		{"GET se reintenta", http.MethodGet, "", 1, http.StatusOK, 2},
+		{"hasta attempts", http.MethodGet, "", 5, http.StatusServiceUnavailable, 3},
+		{"POST no", http.MethodPost, "", 1, http.StatusServiceUnavailable, 1},
+		{"POST con Idempotency-Key sí", http.MethodPost, "k-1", 1, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &flakyBackend{fails: tt.fails}
+			srv := httptest.NewServer(backend)
+			defer srv.Close()
+
+			table, err := NewTable(map[string]config.UpstreamConfig{"a": {
+				URL:            srv.URL,
+				CircuitBreaker: config.CircuitBreakerConfig{Disabled: true},
+			}}, []config.RouteConfig{{
+				Name: "api", Prefix: "/api", Upstream: "a",
+				Retry: config.RetryConfig{
+					Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond,
+					OnStatus: []int{http.StatusServiceUnavailable}, MaxBodyBytes: 1 << 10,
+				},
+			}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table.Commit()
+
+			req := httptest.NewRequest(tt.method, "/api/x", strings.NewReader("cuerpo"))
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			table.Match("/api/x").ServeHTTP(w, req)
+
+			if w.Code != tt.want || len(backend.bodies) != tt.attempts {
+				t.Fatalf("status %d tras %d intentos, se esperaba %d tras %d", w.Code, len(backend.bodies), tt.want, tt.attempts)
+			}
+			// Cada reintento lleva el cuerpo completo
+			for i, b := range backend.bodies {
+				if b != "cuerpo" {
+					t.Errorf("intento %d: cuerpo %q", i+1, b)
+				}
+			}
+		})
+	}
+}
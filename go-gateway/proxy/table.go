@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gateway/config"
+	"gateway/problem"
+	"gateway/requestid"
+)
+
+// Route es una entrada de la tabla ya lista para reenviar peticiones.
+type Route struct {
+	Config config.RouteConfig
+
+	Pool *Pool
+
+	prefix    string // sin "/" final
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+	limiter   *Limiter
+}
+
+// call es el estado de una petición reenviada; viaja en el contexto para que
+// Director, ModifyResponse y ErrorHandler sepan a qué instancia fue.
+type call struct {
+	orig    *http.Request // la petición tal como llegó del cliente
+	target  *Target
+	start   time.Time
+	latency time.Duration // hasta recibir los headers de respuesta
+	failed  bool
+	ignored bool
+	// el plazo lo fijó TimeoutHeader y no el timeout de la ruta
+	clientDeadline bool
+
+	// path y query ya reescritos, sin la base de la instancia
+	path, rawPath, query string
+}
+
+type callKey struct{}
+
+func callFrom(req *http.Request) *call {
+	return req.Context().Value(callKey{}).(*call)
+}
+
+// Table es la tabla de rutas construida a partir de una config. Es inmutable:
+// un reload construye una tabla nueva.
+type Table struct {
+	routes []*Route
+	pools  map[string]*Pool
+	// reconfiguración de los límites heredados de prev, hasta Commit
+	pending []func()
+}
+
+// NewTable construye un reverse proxy por ruta hacia el pool de su upstream.
+// prev es la tabla vigente (o nil): sus instancias conservan el estado de
+// salud y sus rutas el límite de concurrencia y el circuit breaker. prev no
+// se modifica hasta que la tabla nueva se confirma con Commit, así un reload
+// que falla a mitad no cambia lo que está atendiendo.
+func NewTable(upstreams map[string]config.UpstreamConfig, routes []config.RouteConfig, prev *Table) (*Table, error) {
+	t := &Table{pools: map[string]*Pool{}}
+	for _, rc := range routes {
+		up, ok := upstreams[rc.Upstream]
+		if !ok {
+			return nil, fmt.Errorf("ruta %s: upstream %q no definido", rc.Name, rc.Upstream)
+		}
+		pool, ok := t.pools[rc.Upstream]
+		if !ok {
+			var err error
+			if pool, err = NewPool(rc.Upstream, up, prev.pool(rc.Upstream)); err != nil {
+				return nil, err
+			}
+			t.pools[rc.Upstream] = pool
+		}
+
+		route := &Route{
+			Config:    rc,
+			Pool:      pool,
+			prefix:    strings.TrimSuffix(rc.Prefix, "/"),
+			transport: newTransport(rc),
+			limiter:   t.inherit(prev, rc.Name, rc.Concurrency),
+		}
+		route.proxy = &httputil.ReverseProxy{
+			Director:       route.direct,
+			Transport:      &retryTransport{route: route, base: route.transport},
+			ModifyResponse: route.observeResponse,
+			ErrorHandler:   route.handleError,
+		}
+		t.routes = append(t.routes, route)
+	}
+
+	// El prefijo más largo gana
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		return len(t.routes[i].prefix) > len(t.routes[j].prefix)
+	})
+	return t, nil
+}
+
+// Match devuelve la ruta que atiende path, o nil.
+func (t *Table) Match(path string) *Route {
+	for _, r := range t.routes {
+		if r.matches(path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Routes devuelve las rutas en orden de evaluación.
+func (t *Table) Routes() []*Route {
+	return t.routes
+}
+
+// Pools devuelve los pools de upstreams referenciados por alguna ruta.
+func (t *Table) Pools() map[string]*Pool {
+	return t.pools
+}
+
+// inherit devuelve el límite de concurrencia de la ruta name de prev (la
+// config nueva se le aplica en Commit), o uno nuevo.
+func (t *Table) inherit(prev *Table, name string, cfg config.RouteConcurrencyConfig) *Limiter {
+	if prev != nil {
+		for _, r := range prev.routes {
+			if r.Config.Name == name {
+				l := r.limiter
+				t.pending = append(t.pending, func() { l.configure(cfg) })
+				return l
+			}
+		}
+	}
+	return newLimiter(name, cfg)
+}
+
+// Commit aplica la config nueva a los límites, breakers e instancias
+// heredados de la tabla anterior. Se llama una vez, justo antes de publicar
+// la tabla.
+func (t *Table) Commit() {
+	for _, p := range t.pools {
+		p.Commit()
+	}
+	for _, fn := range t.pending {
+		fn()
+	}
+	t.pending = nil
+}
+
+func (t *Table) pool(name string) *Pool {
+	if t == nil {
+		return nil
+	}
+	return t.pools[name]
+}
+
+// StartHealthChecks arranca los chequeos activos de todos los pools.
+func (t *Table) StartHealthChecks() {
+	for _, p := range t.pools {
+		p.StartHealthChecks()
+	}
+}
+
+// Close libera una tabla reemplazada por un reload: detiene sus chequeos
+// activos y cierra las conexiones ociosas de sus transportes. Las peticiones
+// en curso terminan normalmente.
+func (t *Table) Close() {
+	for _, p := range t.pools {
+		p.StopHealthChecks()
+	}
+	for _, r := range t.routes {
+		r.transport.CloseIdleConnections()
+	}
+}
+
+func (r *Route) matches(path string) bool {
+	if r.prefix == "" {
+		return true
+	}
+	return path == r.prefix || strings.HasPrefix(path, r.prefix+"/")
+}
+
+// rewrite aplica rewrite / strip_prefix al path reenviado.
+func (r *Route) rewrite(path string) string {
+	rest := strings.TrimPrefix(path, r.prefix)
+	switch {
+	case r.Config.Rewrite != "":
+		return strings.TrimSuffix(r.Config.Rewrite, "/") + rest
+	case r.Config.StripPrefix:
+		if rest == "" {
+			return "/"
+		}
+		return rest
+	}
+	return path
+}
+
+// direct aplica el rewrite de la ruta y apunta la petición a la instancia
+// elegida. Equivale al Director de httputil.NewSingleHostReverseProxy.
+func (r *Route) direct(req *http.Request) {
+	cl := callFrom(req)
+	cl.path, cl.rawPath, cl.query = r.rewrite(req.URL.Path), "", req.URL.RawQuery
+	if req.URL.RawPath != "" {
+		cl.rawPath = r.rewrite(req.URL.RawPath)
+	}
+	r.pointTo(req, cl)
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// pointTo arma la URL de la petición hacia cl.target (también en reintentos).
+func (r *Route) pointTo(req *http.Request, cl *call) {
+	target := cl.target.URL
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = joinPath(target.Path, cl.path)
+	req.URL.RawPath = ""
+	if cl.rawPath != "" {
+		req.URL.RawPath = joinPath(target.EscapedPath(), cl.rawPath)
+	}
+	switch {
+	case target.RawQuery == "" || cl.query == "":
+		req.URL.RawQuery = target.RawQuery + cl.query
+	default:
+		req.URL.RawQuery = target.RawQuery + "&" + cl.query
+	}
+}
+
+// observeResponse alimenta el chequeo pasivo y el circuit breaker: un 5xx
+// cuenta como fallo.
+func (r *Route) observeResponse(resp *http.Response) error {
+	cl := callFrom(resp.Request)
+	// La respuesta lleva el ID del gateway, no uno que devuelva el upstream
+	resp.Header.Del(requestid.Header)
+	cl.latency = time.Since(cl.start)
+	cl.failed = resp.StatusCode >= 500
+	r.Pool.observe(cl.target, cl.failed, resp.Status)
+	return nil
+}
+
+// handleError responde cuando no se pudo hablar con el upstream: 504 si se
+// venció algún timeout, 502 si no. Cuentan como fallo de la instancia salvo que
+// el cliente cancele o que venza el plazo más corto que pidió el propio cliente.
+func (r *Route) handleError(w http.ResponseWriter, req *http.Request, err error) {
+	cl := callFrom(req)
+	cl.latency = time.Since(cl.start)
+	timeout := isTimeout(err)
+	switch {
+	case errors.Is(err, context.Canceled), timeout && cl.clientDeadline:
+		cl.ignored = true
+	default:
+		cl.failed = true
+		r.Pool.observe(cl.target, true, err.Error())
+	}
+	slog.ErrorContext(req.Context(), "proxy: error", "route", r.Config.Name, "error", err)
+
+	if timeout {
+		problem.Write(w, cl.orig, problem.UpstreamTimeout, "detail.upstream", r.Pool.Name)
+		return
+	}
+	problem.Write(w, cl.orig, problem.BadGateway, "detail.upstream", r.Pool.Name)
+}
+
+func joinPath(a, b string) string {
+	switch {
+	case a == "" || a == "/":
+		return b
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// ServeHTTP elige una instancia del upstream y le reenvía la petición. Antes
+// espera lugar en los límites de concurrencia de la ruta y global. Con el
+// circuito abierto responde 503 enseguida, sin ocupar una conexión al upstream.
+func (r *Route) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	priority := PriorityOf(req)
+	release, err := r.limiter.Acquire(req.Context(), priority)
+	if err != nil {
+		unavailable(w, req, problem.Overloaded, time.Second, "detail.overloaded", r.Config.Name)
+		return
+	}
+	releaseGlobal, err := globalLimiter.Acquire(req.Context(), priority)
+	if err != nil {
+		release(0, false)
+		unavailable(w, req, problem.Overloaded, time.Second, "detail.overloaded", r.Config.Name)
+		return
+	}
+	var cl *call
+	defer func() {
+		var latency time.Duration
+		var failed bool
+		if cl != nil && !cl.ignored {
+			latency, failed = cl.latency, cl.failed
+		}
+		release(latency, failed)
+		releaseGlobal(latency, failed)
+	}()
+
+	target := r.Pool.Pick(req)
+	if target == nil {
+		unavailable(w, req, problem.UpstreamUnavailable, 0, "detail.no_targets", r.Pool.Name)
+		return
+	}
+	ok, wait := r.Pool.Breaker.Allow()
+	if !ok {
+		unavailable(w, req, problem.CircuitOpen, wait, "detail.circuit_open", r.Pool.Name)
+		return
+	}
+	cl = &call{orig: req, target: target, start: time.Now()}
+	target.state.active.Add(1)
+	defer func() {
+		// Un reintento puede haber cambiado de instancia
+		cl.target.state.active.Add(-1)
+		r.Pool.Breaker.done(cl.failed, cl.ignored, cl.latency)
+	}()
+
+	// El plazo es el timeout de la ruta, o el del cliente si es más corto
+	timeout := r.Config.Timeout
+	if d, ok := clientTimeout(req); ok && (timeout == 0 || d < timeout) {
+		timeout = d
+		cl.clientDeadline = true
+	}
+	ctx := context.WithValue(req.Context(), callKey{}, cl)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	r.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+func unavailable(w http.ResponseWriter, req *http.Request, code problem.Code, retryAfter time.Duration, detail string, args ...interface{}) {
+	if retryAfter > 0 {
+		// Redondeado hacia arriba: Retry-After va en segundos enteros
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	problem.Write(w, req, code, detail, args...)
+}
+
+// Concurrency devuelve el estado del límite de concurrencia de cada ruta.
+func (t *Table) Concurrency() []LimiterStatus {
+	out := []LimiterStatus{}
+	for _, r := range t.routes {
+		out = append(out, r.limiter.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Status devuelve el estado de todos los upstreams, ordenados por nombre.
+func (t *Table) Status() []PoolStatus {
+	out := []PoolStatus{}
+	for _, p := range t.pools {
+		out = append(out, p.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+// reloadState es lo que un reload reconfigura sobre el estado heredado.
+type reloadState struct {
+	maxInFlight  int
+	openDuration time.Duration
+	available    bool
+}
+
+func stateOf(r *Route) reloadState {
+	r.limiter.mu.Lock()
+	maxInFlight := r.limiter.cfg.MaxInFlight
+	r.limiter.mu.Unlock()
+	r.Pool.Breaker.mu.Lock()
+	openDuration := r.Pool.Breaker.cfg.OpenDuration
+	r.Pool.Breaker.mu.Unlock()
+	return reloadState{maxInFlight, openDuration, r.Pool.Targets[0].Available()}
+}
+
+func TestReloadDoesNotTouchPreviousTableUntilCommit(t *testing.T) {
+	up := config.UpstreamConfig{
+		URL:            "http://127.0.0.1:1",
+		HealthCheck:    config.HealthCheckConfig{Path: "/health"}, // sin OK todavía: no disponible
+		CircuitBreaker: config.CircuitBreakerConfig{OpenDuration: time.Second},
+	}
+	r1 := config.RouteConfig{Name: "r1", Prefix: "/r1", Upstream: "a", Concurrency: config.RouteConcurrencyConfig{MaxInFlight: 5}}
+	prev, err := NewTable(map[string]config.UpstreamConfig{"a": up}, []config.RouteConfig{r1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := prev.Match("/r1/x")
+	before := stateOf(route)
+
+	// La config nueva cambia todo lo heredado: límite, breaker y chequeo activo
+	up.HealthCheck.Path = ""
+	up.CircuitBreaker.OpenDuration = 2 * time.Second
+	r1.Concurrency.MaxInFlight = 10
+	upstreams := map[string]config.UpstreamConfig{"a": up}
+
+	// Un reload que falla en la segunda ruta no deja nada a medias
+	r2 := config.RouteConfig{Name: "r2", Prefix: "/r2", Upstream: "no-existe"}
+	if _, err := NewTable(upstreams, []config.RouteConfig{r1, r2}, prev); err == nil {
+		t.Fatal("un upstream no definido debía fallar")
+	}
+	if got := stateOf(route); got != before {
+		t.Fatalf("el reload fallido cambió la tabla vigente: %+v, antes %+v", got, before)
+	}
+
+	// Uno que sale bien tampoco, hasta confirmarlo
+	next, err := NewTable(upstreams, []config.RouteConfig{r1}, prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stateOf(route); got != before {
+		t.Fatalf("NewTable cambió la tabla vigente antes de Commit: %+v", got)
+	}
+	next.Commit()
+	want := reloadState{maxInFlight: 10, openDuration: 2 * time.Second, available: true}
+	if got := stateOf(next.Match("/r1/x")); got != want {
+		t.Fatalf("después de Commit: %+v, se esperaba %+v", got, want)
+	}
+	// El estado es el mismo objeto: las peticiones en curso lo siguen viendo
+	if next.Match("/r1/x").limiter != route.limiter || next.Pools()["a"].Breaker != route.Pool.Breaker {
+		t.Error("la tabla nueva debía heredar el límite y el breaker, no copiarlos")
+	}
+}
+
+func TestMatchLongestPrefix(t *testing.T) {
+	up := map[string]config.UpstreamConfig{"a": {URL: "http://127.0.0.1:1"}}
+	table, err := NewTable(up, []config.RouteConfig{
+		{Name: "resto", Prefix: "/", Upstream: "a"},
+		{Name: "api", Prefix: "/api", Upstream: "a"},
+		{Name: "sensores", Prefix: "/api/sensores/", Upstream: "a"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/sensores/5", "sensores"},
+		{"/api/sensores", "sensores"},
+		{"/api/sensoresx", "api"},
+		{"/api", "api"},
+		{"/api/", "api"},
+		{"/apix", "resto"},
+		{"/", "resto"},
+	}
+	for _, tt := range tests {
+		r := table.Match(tt.path)
+		if r == nil || r.Config.Name != tt.want {
+			t.Errorf("Match(%q) = %v, se esperaba %q", tt.path, r, tt.want)
+		}
+	}
+
+	// Sin una ruta "/" lo que no coincide queda sin atender
+	table, err = NewTable(up, []config.RouteConfig{{Name: "api", Prefix: "/api", Upstream: "a"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := table.Match("/otra"); r != nil {
+		t.Errorf("Match(/otra) = %q, se esperaba nil", r.Config.Name)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		route      config.RouteConfig
+		path, want string
+	}{
+		{config.RouteConfig{Prefix: "/python-api"}, "/python-api/x", "/python-api/x"},
+		{config.RouteConfig{Prefix: "/python-api", StripPrefix: true}, "/python-api/x", "/x"},
+		{config.RouteConfig{Prefix: "/python-api/", StripPrefix: true}, "/python-api", "/"},
+		{config.RouteConfig{Prefix: "/python-api", Rewrite: "/api"}, "/python-api/x", "/api/x"},
+		{config.RouteConfig{Prefix: "/python-api", Rewrite: "/api/"}, "/python-api/x", "/api/x"},
+		{config.RouteConfig{Prefix: "/python-api", Rewrite: "/api"}, "/python-api", "/api"},
+		// Rewrite manda sobre strip_prefix
+		{config.RouteConfig{Prefix: "/python-api", Rewrite: "/api", StripPrefix: true}, "/python-api/x", "/api/x"},
+	}
+	for _, tt := range tests {
+		r := &Route{Config: tt.route, prefix: strings.TrimSuffix(tt.route.Prefix, "/")}
+		if got := r.rewrite(tt.path); got != tt.want {
+			t.Errorf("%+v: rewrite(%q) = %q, se esperaba %q", tt.route, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"", "/x", "/x"},
+		{"/", "/x", "/x"},
+		{"/base", "/x", "/base/x"},
+		{"/base/", "/x", "/base/x"},
+		{"/base", "x", "/base/x"},
+		{"/base/", "x", "/base/x"},
+		{"/base", "/", "/base/"},
+	}
+	for _, tt := range tests {
+		if got := joinPath(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, se esperaba %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestForwardedURL(t *testing.T) {
+	var got string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.RequestURI()
+	}))
+	defer backend.Close()
+
+	up := map[string]config.UpstreamConfig{"a": {
+		URL:            backend.URL + "/v1?tenant=planta",
+		CircuitBreaker: config.CircuitBreakerConfig{Disabled: true},
+	}}
+	table, err := NewTable(up, []config.RouteConfig{
+		{Name: "api", Prefix: "/python-api", Upstream: "a", Rewrite: "/api"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Commit()
+
+	tests := []struct {
+		target, want string
+	}{
+		{"/python-api/sensores?desde=1", "/v1/api/sensores?tenant=planta&desde=1"},
+		{"/python-api", "/v1/api?tenant=planta"},
+		// El path escapado se conserva tal cual
+		{"/python-api/a%2Fb", "/v1/api/a%2Fb?tenant=planta"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		table.Match(req.URL.Path).ServeHTTP(w, req)
+		if w.Code != http.StatusOK || got != tt.want {
+			t.Errorf("%s: status %d, el upstream recibió %q, se esperaba %q", tt.target, w.Code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package ratelimit limita peticiones por clave (IP, usuario, ruta...) con
+// token bucket o sliding log. Los contadores viven en un Store: en memoria
+// (por réplica) o en Redis (compartidos entre réplicas).
+package ratelimit
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"gateway/config"
+)
+
+// Limit es Requests peticiones por Period. Burst es la capacidad del token
+// bucket (0 = Requests); el sliding log no admite ráfagas.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// Result es la decisión sobre una petición y el estado de la cuota.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter es cuánto falta para que se permita otra petición (solo si
+	// Allowed es false)
+	RetryAfter time.Duration
+	// Reset es cuánto falta para recuperar la cuota completa
+	Reset time.Duration
+}
+
+// Limiter decide si la petición identificada por key entra en su límite.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+	// Peek devuelve el estado de la cuota de key sin consumirla; Allowed
+	// indica si la próxima petición entraría.
+	Peek(ctx context.Context, key string) (Result, error)
+	// Reset olvida el estado de key: su cuota vuelve a estar completa.
+	Reset(ctx context.Context, key string) error
+	Limit() Limit
+}
+
+// Store guarda el estado de cada clave.
+type Store interface {
+	// Update reemplaza el valor de key por fn(valor actual) y renueva su ttl,
+	// de forma atómica respecto de otras llamadas con la misma key. old es nil
+	// si key no existe o expiró. fn puede llamarse más de una vez (Redis
+	// reintenta si otra réplica tocó la key), así que no debe tener efectos.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(old []byte) []byte) error
+	// Get devuelve el valor de key, o nil si no existe o expiró.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Close() error
+}
+
+// Cada algoritmo guarda el estado en su propio formato: el prefijo separa sus
+// claves en el store, así al cambiar de algoritmo en un reload ninguno lee
+// el estado del otro.
+const (
+	tokenBucketPrefix = "tb|"
+	slidingLogPrefix  = "sl|"
+)
+
+// New crea el limiter del algoritmo indicado (config.Algorithm*) sobre store.
+func New(algorithm string, store Store, limit Limit) Limiter {
+	if algorithm == config.AlgorithmSlidingLog {
+		return &slidingLog{store: store, limit: limit}
+	}
+	return &tokenBucket{store: store, limit: limit}
+}
+
+// NewStore crea el Store del backend configurado. No conecta: Redis abre
+// las conexiones a medida que se usan.
+func NewStore(cfg config.RateLimitStoreConfig) Store {
+	if cfg.Backend == config.BackendRedis {
+		return NewRedis(cfg.Redis)
+	}
+	return NewMemory(cfg.MaxKeys)
+}
+
+// -------------------------
+// Token bucket
+// -------------------------
+// El bucket se rellena a Requests/Period tokens por segundo hasta su
+// capacidad y cada petición consume uno. Estado: tokens (float64) + instante
+// del último cálculo (unix nano).
+
+type tokenBucket struct {
+	store Store
+	limit Limit
+}
+
+func (b *tokenBucket) Limit() Limit { return b.limit }
+
+func (b *tokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	var res Result
+	err := b.store.Update(ctx, tokenBucketPrefix+key, b.ttl(), func(old []byte) []byte {
+		var state []byte
+		res, state = b.take(old, time.Now(), true)
+		return state
+	})
+	return res, err
+}
+
+func (b *tokenBucket) Peek(ctx context.Context, key string) (Result, error) {
+	old, err := b.store.Get(ctx, tokenBucketPrefix+key)
+	if err != nil {
+		return Result{}, err
+	}
+	res, _ := b.take(old, time.Now(), false)
+	return res, nil
+}
+
+func (b *tokenBucket) Reset(ctx context.Context, key string) error {
+	return reset(ctx, b.store, tokenBucketPrefix+key)
+}
+
+// ttl es lo que tarda en llenarse desde vacío; después el estado es irrelevante.
+func (b *tokenBucket) ttl() time.Duration {
+	return seconds(float64(b.limit.capacity())/b.rate()) + time.Second
+}
+
+func (b *tokenBucket) rate() float64 {
+	return float64(b.limit.Requests) / b.limit.Period.Seconds()
+}
+
+// take recalcula el bucket a now y, si consume, gasta un token si hay.
+// Devuelve la decisión y el estado nuevo.
+func (b *tokenBucket) take(old []byte, now time.Time, consume bool) (Result, []byte) {
+	capacity := float64(b.limit.capacity())
+	rate := b.rate()
+
+	tokens := capacity
+	if len(old) == 16 {
+		last := time.Unix(0, int64(binary.BigEndian.Uint64(old[8:])))
+		tokens = math.Float64frombits(binary.BigEndian.Uint64(old[:8]))
+		tokens = math.Min(capacity, tokens+now.Sub(last).Seconds()*rate)
+	}
+
+	res := Result{Limit: int(capacity), Allowed: tokens >= 1}
+	if !res.Allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	} else if consume {
+		tokens--
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((capacity - tokens) / rate)
+
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[:8], math.Float64bits(tokens))
+	binary.BigEndian.PutUint64(buf[8:], uint64(now.UnixNano()))
+	return res, buf
+}
+
+// -------------------------
+// Sliding window log
+// -------------------------
+// Guarda el instante de cada petición aceptada en el último Period (como
+// mucho Requests marcas de 8 bytes) y acepta si hay menos de Requests.
+// Exacto: a diferencia de la ventana fija, no deja pasar 2x en los bordes.
+
+type slidingLog struct {
+	store Store
+	limit Limit
+}
+
+func (l *slidingLog) Limit() Limit { return l.limit }
+
+func (l *slidingLog) Allow(ctx context.Context, key string) (Result, error) {
+	var res Result
+	err := l.store.Update(ctx, slidingLogPrefix+key, l.limit.Period, func(old []byte) []byte {
+		var state []byte
+		res, state = l.take(old, time.Now(), true)
+		return state
+	})
+	return res, err
+}
+
+func (l *slidingLog) Peek(ctx context.Context, key string) (Result, error) {
+	old, err := l.store.Get(ctx, slidingLogPrefix+key)
+	if err != nil {
+		return Result{}, err
+	}
+	res, _ := l.take(old, time.Now(), false)
+	return res, nil
+}
+
+func (l *slidingLog) Reset(ctx context.Context, key string) error {
+	return reset(ctx, l.store, slidingLogPrefix+key)
+}
+
+// take descarta las marcas fuera de la ventana y, si consume y hay lugar,
+// agrega now. Devuelve la decisión y el estado nuevo.
+func (l *slidingLog) take(old []byte, now time.Time, consume bool) (Result, []byte) {
+	from := now.Add(-l.limit.Period).UnixNano()
+
+	log := make([]int64, 0, len(old)/8+1)
+	for i := 0; i+8 <= len(old); i += 8 {
+		if ts := int64(binary.BigEndian.Uint64(old[i:])); ts > from {
+			log = append(log, ts)
+		}
+	}
+
+	res := Result{Limit: l.limit.Requests, Allowed: len(log) < l.limit.Requests}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration(log[0] - from)
+	} else if consume {
+		log = append(log, now.UnixNano())
+	}
+	res.Remaining = l.limit.Requests - len(log)
+	if len(log) > 0 {
+		res.Reset = time.Duration(log[len(log)-1] - from)
+	}
+
+	buf := make([]byte, 8*len(log))
+	for i, ts := range log {
+		binary.BigEndian.PutUint64(buf[8*i:], uint64(ts))
+	}
+	return res, buf
+}
+
+// reset vacía key en store; el valor vencido se descarta enseguida.
+func reset(ctx context.Context, store Store, key string) error {
+	return store.Update(ctx, key, time.Millisecond, func([]byte) []byte { return nil })
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
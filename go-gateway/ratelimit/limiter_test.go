@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+// step es una petición en el instante at (desde t0) y lo que se espera de ella.
+type step struct {
+	at         time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+func TestTokenBucket(t *testing.T) {
+	// Capacidad 3 y un token por segundo
+	b := &tokenBucket{limit: Limit{Requests: 60, Period: time.Minute, Burst: 3}}
+	t0 := time.Unix(1_700_000_000, 0)
+
+	steps := []step{
+		{at: 0, allowed: true, remaining: 2},
+		{at: 0, allowed: true, remaining: 1},
+		{at: 0, allowed: true, remaining: 0},
+		{at: 0, allowed: false, retryAfter: time.Second},
+		{at: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+		{at: time.Second, allowed: true, remaining: 0},
+		// Diez segundos sin pedir nada: se llena hasta la capacidad, no más
+		{at: 11 * time.Second, allowed: true, remaining: 2},
+	}
+
+	var state []byte
+	for i, s := range steps {
+		var res Result
+		res, state = b.take(state, t0.Add(s.at), true)
+		checkStep(t, i, s, res)
+		if res.Limit != 3 {
+			t.Errorf("paso %d: Limit = %d, se esperaba 3", i, res.Limit)
+		}
+	}
+}
+
+func TestTokenBucketPeekDoesNotConsume(t *testing.T) {
+	b := &tokenBucket{limit: Limit{Requests: 2, Period: time.Minute}}
+	now := time.Unix(1_700_000_000, 0)
+
+	_, state := b.take(nil, now, true)
+	for i := 0; i < 3; i++ {
+		res, _ := b.take(state, now, false)
+		if !res.Allowed || res.Remaining != 1 {
+			t.Fatalf("peek %d: %+v, se esperaba permitido con 1 restante", i, res)
+		}
+	}
+}
+
+func TestSlidingLog(t *testing.T) {
+	l := &slidingLog{limit: Limit{Requests: 2, Period: 10 * time.Second}}
+	t0 := time.Unix(1_700_000_000, 0)
+
+	steps := []step{
+		{at: 0, allowed: true, remaining: 1},
+		{at: time.Second, allowed: true, remaining: 0},
+		// La primera marca sale de la ventana a los 10s
+		{at: 2 * time.Second, allowed: false, retryAfter: 8 * time.Second},
+		{at: 9 * time.Second, allowed: false, retryAfter: time.Second},
+		{at: 10 * time.Second, allowed: true, remaining: 0},
+		// Sin ráfagas: en el borde de la ventana no pasa el doble
+		{at: 10*time.Second + time.Millisecond, allowed: false, retryAfter: time.Second - time.Millisecond},
+		{at: 30 * time.Second, allowed: true, remaining: 1},
+	}
+
+	var state []byte
+	for i, s := range steps {
+		var res Result
+		res, state = l.take(state, t0.Add(s.at), true)
+		checkStep(t, i, s, res)
+	}
+	if len(state) != 8 {
+		t.Errorf("el log guarda %d bytes, se esperaba una sola marca", len(state))
+	}
+}
+
+func TestLimiterOnMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range []string{config.AlgorithmTokenBucket, config.AlgorithmSlidingLog} {
+		t.Run(algorithm, func(t *testing.T) {
+			l := New(algorithm, NewMemory(0), Limit{Requests: 3, Period: time.Hour})
+			for i := 0; i < 3; i++ {
+				if res, err := l.Allow(ctx, "a"); err != nil || !res.Allowed {
+					t.Fatalf("petición %d: %+v, %v", i, res, err)
+				}
+			}
+			if res, _ := l.Allow(ctx, "a"); res.Allowed {
+				t.Fatal("la cuarta petición debía rechazarse")
+			}
+			// Cada clave tiene su propia cuota
+			if res, _ := l.Allow(ctx, "b"); !res.Allowed {
+				t.Fatal("otra clave no debía verse afectada")
+			}
+			if res, _ := l.Peek(ctx, "a"); res.Allowed || res.Remaining != 0 {
+				t.Fatalf("peek de una clave agotada: %+v", res)
+			}
+		})
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2)
+	set := func(key string) {
+		m.Update(ctx, key, time.Hour, func([]byte) []byte { return []byte(key) })
+	}
+	set("a")
+	set("b")
+	set("a") // "b" pasa a ser la menos usada
+	set("c")
+
+	if m.Len() != 2 {
+		t.Fatalf("Len = %d, se esperaba 2", m.Len())
+	}
+	if v, _ := m.Get(ctx, "b"); v != nil {
+		t.Errorf("b debía descartarse, vale %q", v)
+	}
+	if v, _ := m.Get(ctx, "a"); string(v) != "a" {
+		t.Errorf("a = %q", v)
+	}
+}
+
+func checkStep(t *testing.T, i int, s step, res Result) {
+	t.Helper()
+	if res.Allowed != s.allowed {
+		t.Fatalf("paso %d (+%v): Allowed = %v, se esperaba %v", i, s.at, res.Allowed, s.allowed)
+	}
+	if s.allowed && res.Remaining != s.remaining {
+		t.Errorf("paso %d (+%v): Remaining = %d, se esperaba %d", i, s.at, res.Remaining, s.remaining)
+	}
+	if !s.allowed && !near(res.RetryAfter, s.retryAfter) {
+		t.Errorf("paso %d (+%v): RetryAfter = %v, se esperaba %v", i, s.at, res.RetryAfter, s.retryAfter)
+	}
+}
+
+// near tolera el redondeo de pasar de float64 a time.Duration.
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -time.Microsecond && d < time.Microsecond
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory es un Store local con expiración por clave (TTL) y un máximo de
+// claves: al superarlo se descartan las menos usadas (LRU). Descartar una
+// clave solo le devuelve la cuota completa a ese cliente.
+type Memory struct {
+	mu      sync.Mutex
+	maxKeys int
+	lru     *list.List // frente = usada más recientemente
+	items   map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory crea el store; maxKeys 0 = sin máximo (solo TTL).
+func NewMemory(maxKeys int) *Memory {
+	return &Memory{
+		maxKeys: maxKeys,
+		lru:     list.New(),
+		items:   map[string]*list.Element{},
+	}
+}
+
+func (m *Memory) Update(ctx context.Context, key string, ttl time.Duration, fn func(old []byte) []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := m.items[key]; ok {
+		e := el.Value.(*memoryEntry)
+		var old []byte
+		if now.Before(e.expires) {
+			old = e.value
+		}
+		e.value = fn(old)
+		e.expires = now.Add(ttl)
+		m.lru.MoveToFront(el)
+		return nil
+	}
+
+	m.items[key] = m.lru.PushFront(&memoryEntry{key: key, value: fn(nil), expires: now.Add(ttl)})
+	m.evict(now)
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		if e := el.Value.(*memoryEntry); time.Now().Before(e.expires) {
+			return e.value, nil
+		}
+	}
+	return nil, nil
+}
+
+// evict saca del fondo de la lista las claves vencidas y, si aún sobran, las
+// menos usadas. Las vencidas que no llegan al fondo se pisan al volver a usarse.
+func (m *Memory) evict(now time.Time) {
+	for el := m.lru.Back(); el != nil; el = m.lru.Back() {
+		e := el.Value.(*memoryEntry)
+		if now.Before(e.expires) && (m.maxKeys <= 0 || m.lru.Len() <= m.maxKeys) {
+			return
+		}
+		m.lru.Remove(el)
+		delete(m.items, e.key)
+	}
+}
+
+// Len devuelve la cantidad de claves guardadas (incluidas vencidas aún no descartadas).
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gateway/config"
+)
+
+// ErrConflict indica que la clave cambió en todos los intentos de Update
+// (demasiadas peticiones escribiendo la misma clave a la vez).
+var ErrConflict = errors.New("ratelimit: conflicto persistente en redis")
+
+// redisAttempts es cuántas veces se reintenta un Update si otra réplica
+// modificó la clave entre el GET y el EXEC.
+const redisAttempts = 8
+
+// Redis es un Store compartido que habla el protocolo de Redis (RESP). Cada
+// Update es un check-and-set optimista: WATCH + GET, y MULTI + SET PX + EXEC;
+// si EXEC falla porque la clave cambió, se vuelve a empezar. Solo usa
+// comandos básicos, así que sirve cualquier servidor compatible.
+type Redis struct {
+	cfg    config.RateLimitRedisConfig
+	idle   chan *redisConn
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewRedis crea el store; las conexiones se abren a medida que se usan y se
+// guardan hasta PoolSize inactivas.
+func NewRedis(cfg config.RateLimitRedisConfig) *Redis {
+	return &Redis{cfg: cfg, idle: make(chan *redisConn, cfg.PoolSize)}
+}
+
+func (s *Redis) Update(ctx context.Context, key string, ttl time.Duration, fn func(old []byte) []byte) error {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	key = s.cfg.Prefix + key
+	px := strconv.FormatInt(ttl.Milliseconds()+1, 10)
+	for attempt := 0; attempt < redisAttempts; attempt++ {
+		replies, err := conn.pipeline(
+			[]string{"WATCH", key},
+			[]string{"GET", key},
+		)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		old, _ := replies[1].([]byte)
+
+		replies, err = conn.pipeline(
+			[]string{"MULTI"},
+			[]string{"SET", key, string(fn(old)), "PX", px},
+			[]string{"EXEC"},
+		)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		// EXEC devuelve nil si la clave vigilada cambió
+		if replies[2] != nil {
+			s.put(conn)
+			return nil
+		}
+		// Espera al azar para no volver a chocar con las mismas peticiones
+		time.Sleep(time.Duration(rand.Int63n(int64(attempt+1) * int64(time.Millisecond))))
+	}
+	s.put(conn)
+	return ErrConflict
+}
+
+func (s *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	replies, err := conn.pipeline([]string{"GET", s.cfg.Prefix + key})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.put(conn)
+	v, _ := replies[0].([]byte)
+	return v, nil
+}
+
+func (s *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+
+	d := net.Dialer{Timeout: s.cfg.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	c.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	var setup [][]string
+	if s.cfg.Password != "" {
+		setup = append(setup, []string{"AUTH", s.cfg.Password})
+	}
+	if s.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.cfg.DB)})
+	}
+	if len(setup) > 0 {
+		if _, err := c.pipeline(setup...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *Redis) put(c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// Close cierra las conexiones inactivas; las que están en uso se cierran al devolverse.
+func (s *Redis) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// -------------------------
+// RESP
+// -------------------------
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError es una respuesta de error del servidor ("-ERR ...").
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// pipeline manda los comandos juntos y lee una respuesta por comando. Si
+// alguna es un error del servidor se devuelve ese error.
+func (c *redisConn) pipeline(cmds ...[]string) ([]interface{}, error) {
+	w := bufio.NewWriter(c.Conn)
+	for _, args := range cmds {
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		v, err := c.read()
+		if err != nil {
+			var re redisError
+			if !errors.As(err, &re) {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[i] = v
+	}
+	return replies, firstErr
+}
+
+// read lee una respuesta: string simple, entero, bulk ([]byte o nil) o
+// array ([]interface{} o nil).
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: respuesta mal formada")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			if out[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: tipo de respuesta desconocido %q", kind)
+}
@@ -0,0 +1,388 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+// -------------------------
+// Servidor RESP de prueba
+// -------------------------
+// Implementa lo que usa el store (AUTH, SELECT, GET, SET PX, WATCH, MULTI,
+// EXEC) con la misma semántica que Redis: EXEC devuelve nil si una clave
+// vigilada cambió desde el WATCH.
+
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	data     map[string]fakeEntry
+	versions map[string]int
+	commands map[string]int
+}
+
+type fakeEntry struct {
+	value   string
+	expires time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		ln:       ln,
+		password: password,
+		data:     map[string]fakeEntry{},
+		versions: map[string]int{},
+		commands: map[string]int{},
+	}
+	go s.serve()
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *fakeRedis) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeRedis) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, nc)
+		s.mu.Unlock()
+		go s.handle(nc)
+	}
+}
+
+// stop simula la caída del servidor: deja de escuchar y corta las conexiones.
+func (s *fakeRedis) stop() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, nc := range s.conns {
+		nc.Close()
+	}
+}
+
+func (s *fakeRedis) accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// set escribe key como lo haría otro cliente (p.ej. otra réplica).
+func (s *fakeRedis) set(key, value string, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = fakeEntry{value, time.Now().Add(ttl)}
+	s.versions[key]++
+}
+
+func (s *fakeRedis) get(key string) (fakeEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.data[key]
+	if ok && time.Now().After(e.expires) {
+		return fakeEntry{}, false
+	}
+	return e, ok
+}
+
+func (s *fakeRedis) count(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands[cmd]
+}
+
+func (s *fakeRedis) handle(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+
+	authed := s.password == ""
+	var watched map[string]int
+	var queued [][]string
+	inMulti := false
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		s.mu.Lock()
+		s.commands[cmd]++
+		s.mu.Unlock()
+
+		switch {
+		case cmd == "AUTH":
+			if args[1] != s.password {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+				break
+			}
+			authed = true
+			w.WriteString("+OK\r\n")
+		case !authed:
+			w.WriteString("-NOAUTH Authentication required\r\n")
+		case cmd == "SELECT":
+			w.WriteString("+OK\r\n")
+		case cmd == "WATCH":
+			s.mu.Lock()
+			watched = map[string]int{args[1]: s.versions[args[1]]}
+			s.mu.Unlock()
+			w.WriteString("+OK\r\n")
+		case cmd == "GET":
+			if e, ok := s.get(args[1]); ok {
+				fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+			} else {
+				w.WriteString("$-1\r\n")
+			}
+		case cmd == "MULTI":
+			inMulti, queued = true, nil
+			w.WriteString("+OK\r\n")
+		case cmd == "SET" && inMulti:
+			queued = append(queued, args)
+			w.WriteString("+QUEUED\r\n")
+		case cmd == "EXEC":
+			s.mu.Lock()
+			changed := false
+			for k, v := range watched {
+				changed = changed || s.versions[k] != v
+			}
+			s.mu.Unlock()
+			inMulti, watched = false, nil
+			if changed {
+				w.WriteString("*-1\r\n")
+				break
+			}
+			fmt.Fprintf(w, "*%d\r\n", len(queued))
+			for _, q := range queued {
+				ms, _ := strconv.Atoi(q[4]) // SET key value PX ms
+				s.set(q[1], q[2], time.Duration(ms)*time.Millisecond)
+				w.WriteString("+OK\r\n")
+			}
+		default:
+			fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand lee un comando como array de bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("se esperaba un array")
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func redisConfig(addr string) config.RateLimitRedisConfig {
+	return config.RateLimitRedisConfig{
+		Addr:     addr,
+		Prefix:   "rl:",
+		Timeout:  time.Second,
+		PoolSize: 2,
+	}
+}
+
+// -------------------------
+// Tests
+// -------------------------
+
+func TestRedisUpdateAndGet(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, "")
+	s := NewRedis(redisConfig(srv.addr()))
+	defer s.Close()
+
+	for i := 1; i <= 3; i++ {
+		err := s.Update(ctx, "k", time.Minute, func(old []byte) []byte {
+			return append(old, 'x')
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	v, err := s.Get(ctx, "k")
+	if err != nil || string(v) != "xxx" {
+		t.Fatalf("Get = %q, %v; se esperaba \"xxx\"", v, err)
+	}
+	// Las claves llevan el prefijo y el TTL pedido
+	e, ok := srv.get("rl:k")
+	if !ok || e.value != "xxx" {
+		t.Fatalf("en el servidor: %+v, %v", e, ok)
+	}
+	if ttl := time.Until(e.expires); ttl < 59*time.Second || ttl > time.Minute+time.Second {
+		t.Errorf("TTL = %v, se esperaba ~1m", ttl)
+	}
+	if v, _ := s.Get(ctx, "otra"); v != nil {
+		t.Errorf("una clave inexistente devolvió %q", v)
+	}
+	// Todo por la misma conexión del pool
+	if n := srv.accepted(); n != 1 {
+		t.Errorf("se abrieron %d conexiones, se esperaba 1", n)
+	}
+	if n := srv.count("AUTH") + srv.count("SELECT"); n != 0 {
+		t.Errorf("sin password ni db no debía mandar AUTH/SELECT (%d)", n)
+	}
+}
+
+func TestRedisRetriesWhenKeyChanges(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, "")
+	s := NewRedis(redisConfig(srv.addr()))
+	defer s.Close()
+
+	// Entre el GET y el EXEC otra réplica escribe la clave una vez
+	calls := 0
+	err := s.Update(ctx, "k", time.Minute, func(old []byte) []byte {
+		calls++
+		if calls == 1 {
+			srv.set("rl:k", "otra", time.Minute)
+		}
+		return append(append([]byte{}, old...), '+')
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("fn se llamó %d veces, se esperaban 2", calls)
+	}
+	if e, _ := srv.get("rl:k"); e.value != "otra+" {
+		t.Errorf("valor = %q: debía recalcularse sobre lo que escribió la otra réplica", e.value)
+	}
+}
+
+func TestRedisPersistentConflict(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	s := NewRedis(redisConfig(srv.addr()))
+	defer s.Close()
+
+	err := s.Update(context.Background(), "k", time.Minute, func(old []byte) []byte {
+		srv.set("rl:k", "otra", time.Minute)
+		return []byte("mio")
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("err = %v, se esperaba ErrConflict", err)
+	}
+	if n := srv.count("EXEC"); n != redisAttempts {
+		t.Errorf("EXEC %d veces, se esperaban %d", n, redisAttempts)
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, "secreto")
+
+	cfg := redisConfig(srv.addr())
+	cfg.Password = "otro"
+	bad := NewRedis(cfg)
+	defer bad.Close()
+	if _, err := bad.Get(ctx, "k"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("con password incorrecta: %v", err)
+	}
+
+	cfg.Password = "secreto"
+	cfg.DB = 3
+	good := NewRedis(cfg)
+	defer good.Close()
+	if err := good.Update(ctx, "k", time.Minute, func([]byte) []byte { return []byte("v") }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := good.Get(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	// AUTH y SELECT van una vez por conexión, no por comando
+	if srv.count("AUTH") != 2 || srv.count("SELECT") != 1 {
+		t.Errorf("AUTH = %d, SELECT = %d", srv.count("AUTH"), srv.count("SELECT"))
+	}
+}
+
+func TestRedisDown(t *testing.T) {
+	// Un puerto que estuvo abierto y ya no escucha
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := NewRedis(redisConfig(addr))
+	defer s.Close()
+	l := New(config.AlgorithmTokenBucket, s, Limit{Requests: 1, Period: time.Minute})
+
+	_, err = l.Allow(context.Background(), "k")
+	if err == nil {
+		t.Fatal("con Redis caído Allow debía devolver el error del store")
+	}
+	// Quien decide dejar pasar es el middleware; el store no lo confunde con un conflicto
+	if errors.Is(err, ErrConflict) {
+		t.Fatal("un error de conexión no es ErrConflict")
+	}
+}
+
+func TestRedisServerGoesAway(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, "")
+	s := NewRedis(redisConfig(srv.addr()))
+	defer s.Close()
+
+	if err := s.Update(ctx, "k", time.Minute, func([]byte) []byte { return []byte("v") }); err != nil {
+		t.Fatal(err)
+	}
+	// La conexión que quedó en el pool ya no sirve: falla, no se cuelga
+	srv.stop()
+	done := make(chan error, 1)
+	go func() { _, err := s.Get(ctx, "k"); done <- err }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Get con el servidor caído no devolvió error")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Get se colgó con el servidor caído")
+	}
+	// Y no vuelve al pool: la siguiente intenta conectar de nuevo
+	if _, err := s.Get(ctx, "k"); err == nil {
+		t.Fatal("con el servidor caído no debía poder conectar")
+	}
+}
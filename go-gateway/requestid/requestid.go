@@ -0,0 +1,54 @@
+// Package requestid identifica cada petición con un ID (header X-Request-ID)
+// que viaja en el contexto, en los logs, en las respuestas de error y en las
+// peticiones a los upstreams, para poder seguirla de punta a punta.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header lleva el ID en peticiones y respuestas.
+const Header = "X-Request-ID"
+
+// maxLen acota el ID que se acepta del cliente (termina en logs y upstreams).
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New genera un ID aleatorio (16 caracteres hex).
+func New() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid indica si id se puede aceptar tal cual del cliente: no vacío, hasta
+// 128 caracteres y solo letras, dígitos y "-_.:" (así no ensucia los logs
+// ni los headers hacia los upstreams).
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch ch := id[i]; {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithID devuelve ctx con el ID de la petición.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext devuelve el ID de la petición, o "" si no tiene.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
@@ -0,0 +1,123 @@
+// Package tracing configura OpenTelemetry: el TracerProvider global con su
+// exportador (OTLP/HTTP, stdout o archivo), el muestreo y la propagación W3C
+// (traceparent/tracestate) hacia y desde los otros servicios. Los spans los
+// abre cada paquete con otel.Tracer.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"gateway/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Init instala el TracerProvider según cfg y devuelve la función que vacía los
+// spans pendientes al terminar. Con exporter none no se registra nada, pero el
+// traceparent que llega se sigue pasando a los upstreams.
+func Init(cfg config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	Configure(cfg)
+
+	var exp sdktrace.SpanExporter
+	var file io.Closer
+	switch cfg.Exporter {
+	case config.TracingNone:
+		return func(context.Context) error { return nil }, nil
+	case config.TracingOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exp, err = otlptracehttp.New(context.Background(), opts...)
+	case config.TracingStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TracingFile:
+		f, ferr := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if ferr != nil {
+			return nil, fmt.Errorf("tracing: %w", ferr)
+		}
+		file = f
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	// stdout y file son para probar en local: cada span se escribe al cerrarse
+	export := sdktrace.WithBatcher(exp)
+	if cfg.Exporter != config.TracingOTLP {
+		export = sdktrace.WithSyncer(exp)
+	}
+	tp := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(res),
+		// Si el llamador ya decidió (traceparent con o sin sampled) se respeta
+		sdktrace.WithSampler(sdktrace.ParentBased(rootSampler{})),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// -------------------------
+// Muestreo (recargable)
+// -------------------------
+
+var sampler atomic.Value // sdktrace.Sampler
+
+// Configure aplica sample_rate; es lo único del trazado que se recarga en
+// caliente.
+func Configure(cfg config.TracingConfig) {
+	sampler.Store(sdktrace.TraceIDRatioBased(cfg.SampleRate))
+}
+
+// rootSampler decide las trazas que empiezan en el gateway con el sample_rate
+// vigente.
+type rootSampler struct{}
+
+func (rootSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return sampler.Load().(sdktrace.Sampler).ShouldSample(p)
+}
+
+func (rootSampler) Description() string {
+	return "GatewaySampleRate"
+}
+
+// -------------------------
+// Helpers
+// -------------------------
+
+// End cierra span marcándolo como fallido si err no es nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}